@@ -0,0 +1,273 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/hajimehoshi/ebiten"
+	"github.com/hajimehoshi/ebiten/ebitenutil"
+)
+
+const (
+	histogramHeigh = 128
+	waveformWidth  = 256
+	panelScale     = 0.5
+	panelMargin    = 4
+	// share of pixels at 0 or 255 above which a channel is clipped.
+	clippingThreshold = 0.005
+)
+
+var (
+	showHistogram   = false
+	showWaveform    = false
+	showVectorscope = false
+)
+
+// frameStats holds the analysis of a frame.
+type frameStats struct {
+	pixels     int
+	histogram  [3][256]int
+	shadows    [3]int // pixels at 0 per channel
+	highlights [3]int // pixels at 255 per channel
+	// waveform counts the luma values per column bucket.
+	waveform [waveformWidth][256]int
+	// vectorscope counts the chroma values (Cb, Cr).
+	vectorscope [256][256]int
+}
+
+// panelStats is reused from frame to frame: the waveform and the
+// vectorscope are too large to be allocated at each frame.
+var panelStats frameStats
+
+// computeStats analyses img for the enabled panels only. The result
+// is valid until the next call.
+func computeStats(img *imageRGB) *frameStats {
+	stats := &panelStats
+	stats.pixels = 0
+	if showHistogram {
+		stats.histogram = [3][256]int{}
+		stats.shadows = [3]int{}
+		stats.highlights = [3]int{}
+	}
+	if showWaveform {
+		stats.waveform = [waveformWidth][256]int{}
+	}
+	if showVectorscope {
+		stats.vectorscope = [256][256]int{}
+	}
+	for y := 0; y < img.heigh; y++ {
+		for x := 0; x < img.width; x++ {
+			i := 3 * (y*img.width + x)
+			if i+2 >= len(img.pixels) {
+				continue
+			}
+			pixel := img.pixels[i : i+3]
+			stats.pixels++
+			if showHistogram {
+				for c, value := range pixel {
+					stats.histogram[c][value]++
+					if value == 0 {
+						stats.shadows[c]++
+					} else if value == 255 {
+						stats.highlights[c]++
+					}
+				}
+			}
+			if showWaveform || showVectorscope {
+				Y, U, V := color.RGBToYCbCr(pixel[0], pixel[1], pixel[2])
+				if showWaveform {
+					stats.waveform[x*waveformWidth/img.width][Y]++
+				}
+				if showVectorscope {
+					stats.vectorscope[U][V]++
+				}
+			}
+		}
+	}
+	return stats
+}
+
+// clipping describes the channels with too many clipped pixels.
+func (s *frameStats) clipping() string {
+	if s.pixels == 0 {
+		return ""
+	}
+	text := ""
+	for c, name := range []string{"R", "G", "B"} {
+		low := float64(s.shadows[c]) / float64(s.pixels)
+		high := float64(s.highlights[c]) / float64(s.pixels)
+		if low > clippingThreshold || high > clippingThreshold {
+			text += fmt.Sprintf("%s %.1f%%/%.1f%% ", name,
+				100*low, 100*high)
+		}
+	}
+	if text == "" {
+		return ""
+	}
+	return "clip " + text
+}
+
+// intensity maps a count to a brightness using a square root scale.
+func intensity(count, max int) uint8 {
+	if count == 0 || max == 0 {
+		return 0
+	}
+	return uint8(64 + 191*math.Sqrt(float64(count)/float64(max)))
+}
+
+var panelBackground = color.RGBA{0, 0, 0, 0xa0}
+
+// histogramPanel draws the three channels histograms. The borders
+// are red when the shadows or the highlights are clipped.
+func (s *frameStats) histogramPanel() *image.RGBA {
+	panel := image.NewRGBA(image.Rect(0, 0, 256, histogramHeigh))
+	max := 1
+	for c := range s.histogram {
+		// ignore the extremes to keep the scale readable.
+		for value := 1; value < 255; value++ {
+			if s.histogram[c][value] > max {
+				max = s.histogram[c][value]
+			}
+		}
+	}
+	for x := 0; x < 256; x++ {
+		for y := 0; y < histogramHeigh; y++ {
+			col := panelBackground
+			level := histogramHeigh - y
+			for c := range s.histogram {
+				if s.histogram[c][x]*histogramHeigh/max >= level {
+					switch c {
+					case 0:
+						col.R = 0xff
+					case 1:
+						col.G = 0xff
+					case 2:
+						col.B = 0xff
+					}
+					col.A = 0xff
+				}
+			}
+			panel.Set(x, y, col)
+		}
+	}
+	red := color.RGBA{0xff, 0, 0, 0xff}
+	for c := range s.histogram {
+		if float64(s.shadows[c]) > clippingThreshold*float64(s.pixels) {
+			for y := 0; y < histogramHeigh; y++ {
+				panel.Set(0, y, red)
+				panel.Set(1, y, red)
+			}
+		}
+		if float64(s.highlights[c]) > clippingThreshold*float64(s.pixels) {
+			for y := 0; y < histogramHeigh; y++ {
+				panel.Set(254, y, red)
+				panel.Set(255, y, red)
+			}
+		}
+	}
+	return panel
+}
+
+// waveformPanel draws the luma distribution of each column: the
+// horizontal axis follows the image and the vertical axis is the luma.
+func (s *frameStats) waveformPanel() *image.RGBA {
+	panel := image.NewRGBA(image.Rect(0, 0, waveformWidth, 256))
+	max := 0
+	for x := range s.waveform {
+		for _, count := range s.waveform[x] {
+			if count > max {
+				max = count
+			}
+		}
+	}
+	for x := range s.waveform {
+		for luma, count := range s.waveform[x] {
+			col := panelBackground
+			if level := intensity(count, max); level != 0 {
+				col = color.RGBA{0, level, 0, 0xff}
+			}
+			panel.Set(x, 255-luma, col)
+		}
+	}
+	return panel
+}
+
+// vectorscopePanel draws the chroma distribution: Cb on the
+// horizontal axis and Cr on the vertical axis.
+func (s *frameStats) vectorscopePanel() *image.RGBA {
+	panel := image.NewRGBA(image.Rect(0, 0, 256, 256))
+	max := 0
+	for u := range s.vectorscope {
+		for v := range s.vectorscope[u] {
+			// ignore the gray pixels which dominate most frames.
+			if u != 128 || v != 128 {
+				if s.vectorscope[u][v] > max {
+					max = s.vectorscope[u][v]
+				}
+			}
+		}
+	}
+	for u := range s.vectorscope {
+		for v := range s.vectorscope[u] {
+			col := panelBackground
+			if level := intensity(s.vectorscope[u][v], max); level != 0 {
+				r, g, b := color.YCbCrToRGB(level, uint8(u), uint8(v))
+				col = color.RGBA{r, g, b, 0xff}
+			} else if u == 128 || v == 128 {
+				col = color.RGBA{0x60, 0x60, 0x60, 0xff}
+			}
+			panel.Set(u, 255-v, col)
+		}
+	}
+	return panel
+}
+
+// drawPanels draws the enabled analysis panels along the right side
+// of the screen.
+func drawPanels(screen *ebiten.Image, width, heigh int) error {
+	if lastRaw == nil ||
+		!(showHistogram || showWaveform || showVectorscope) {
+		return nil
+	}
+	stats := computeStats(lastRaw)
+	var panels []*image.RGBA
+	if showHistogram {
+		panels = append(panels, stats.histogramPanel())
+	}
+	if showWaveform {
+		panels = append(panels, stats.waveformPanel())
+	}
+	if showVectorscope {
+		panels = append(panels, stats.vectorscopePanel())
+	}
+	// shrink the panels to fit in the screen.
+	scale, total := panelScale, 0
+	for _, panel := range panels {
+		total += panel.Bounds().Dy()
+	}
+	available := float64(heigh - (len(panels)+1)*panelMargin)
+	if float64(total)*scale > available {
+		scale = available / float64(total)
+	}
+	y := float64(panelMargin)
+	for _, panel := range panels {
+		img, err := ebiten.NewImageFromImage(panel, ebiten.FilterDefault)
+		if err != nil {
+			return err
+		}
+		size := panel.Bounds().Size()
+		x := float64(width) - float64(size.X)*scale - panelMargin
+		op := &ebiten.DrawImageOptions{}
+		op.GeoM.Scale(scale, scale)
+		op.GeoM.Translate(x, y)
+		screen.DrawImage(img, op)
+		y += float64(size.Y)*scale + panelMargin
+	}
+	if showHistogram {
+		// below the status line.
+		ebitenutil.DebugPrintAt(screen, stats.clipping(), 0, debugCharHeigh)
+	}
+	return nil
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image/jpeg"
+	"io"
+	"math"
+	"os"
+	"time"
+)
+
+const (
+	aviHasIndex = 0x10 // AVIF_HASINDEX
+	aviKeyFrame = 0x10 // AVIIF_KEYFRAME
+	// aviMaxSize is the size limit of an AVI file without the
+	// OpenDML extension.
+	aviMaxSize = math.MaxUint32
+	// aviMaxGap is the longest gap in seconds filled with empty
+	// chunks. After a longer gap the timeline restarts with the
+	// frame.
+	aviMaxGap = 5
+)
+
+// errAVIFull is returned when a frame does not fit in the file.
+var errAVIFull = errors.New("AVI file size limit (4 GB) reached")
+
+// aviIndexEntry is an entry of the idx1 chunk.
+type aviIndexEntry struct {
+	offset uint32 // relative to the movi list type
+	size   uint32
+}
+
+// aviWriter writes a Motion-JPEG AVI file. The frame rate is fixed:
+// frames are placed according to their timestamp, missing frames are
+// written as empty chunks (the previous frame is shown again) and
+// early frames are dropped. The file is limited to 4 GB.
+type aviWriter struct {
+	file   *os.File
+	width  int
+	heigh  int
+	rate   int
+	start  time.Time
+	index  []aviIndexEntry
+	movi   int64 // position of the movi list type
+	offset int64 // current position
+	maxLen uint32
+
+	// positions of the fields patched when the file is closed.
+	riffSize    int64
+	totalFrames int64
+	maxBytes    int64
+	bufferSize  int64
+	length      int64
+	moviSize    int64
+}
+
+func newAVIWriter(filename string, width, heigh, rate int) (*aviWriter, error) {
+	file, err := os.Create(filename)
+	if err != nil {
+		return nil, fmt.Errorf("create avi: %s", err)
+	}
+	a := &aviWriter{
+		file:  file,
+		width: width,
+		heigh: heigh,
+		rate:  rate,
+	}
+	if err := a.writeHeader(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("write avi header: %s", err)
+	}
+	return a, nil
+}
+
+func (a *aviWriter) write(data ...interface{}) error {
+	for _, d := range data {
+		if s, ok := d.(string); ok {
+			d = []byte(s)
+		}
+		if err := binary.Write(a.file, binary.LittleEndian, d); err != nil {
+			return err
+		}
+		a.offset += int64(binary.Size(d))
+	}
+	return nil
+}
+
+func (a *aviWriter) writeHeader() error {
+	const (
+		avihSize = 56
+		strhSize = 56
+		strfSize = 40
+		strlSize = 4 + 8 + strhSize + 8 + strfSize
+		hdrlSize = 4 + 8 + avihSize + 8 + strlSize
+	)
+	a.riffSize = 4
+	if err := a.write("RIFF", uint32(0), "AVI "); err != nil {
+		return err
+	}
+	if err := a.write("LIST", uint32(hdrlSize), "hdrl"); err != nil {
+		return err
+	}
+
+	// MainAVIHeader
+	if err := a.write("avih", uint32(avihSize),
+		uint32(1000000/a.rate), // microseconds per frame
+	); err != nil {
+		return err
+	}
+	a.maxBytes = a.offset
+	if err := a.write(uint32(0), // max bytes per second
+		uint32(0),           // padding granularity
+		uint32(aviHasIndex), // flags
+	); err != nil {
+		return err
+	}
+	a.totalFrames = a.offset
+	if err := a.write(uint32(0), // total frames
+		uint32(0), // initial frames
+		uint32(1), // streams
+	); err != nil {
+		return err
+	}
+	a.bufferSize = a.offset
+	if err := a.write(uint32(0), // suggested buffer size
+		uint32(a.width), uint32(a.heigh),
+		[4]uint32{}, // reserved
+	); err != nil {
+		return err
+	}
+
+	// AVIStreamHeader
+	if err := a.write("LIST", uint32(strlSize), "strl"); err != nil {
+		return err
+	}
+	if err := a.write("strh", uint32(strhSize), "vids", "MJPG",
+		uint32(0), // flags
+		uint16(0), // priority
+		uint16(0), // language
+		uint32(0), // initial frames
+		uint32(1), // scale
+		uint32(a.rate),
+		uint32(0), // start
+	); err != nil {
+		return err
+	}
+	a.length = a.offset
+	if err := a.write(uint32(0), // length
+		uint32(0), // suggested buffer size
+		int32(-1), // quality
+		uint32(0), // sample size
+		[4]int16{0, 0, int16(a.width), int16(a.heigh)},
+	); err != nil {
+		return err
+	}
+
+	// BITMAPINFOHEADER
+	if err := a.write("strf", uint32(strfSize),
+		uint32(strfSize),
+		int32(a.width), int32(a.heigh),
+		uint16(1),  // planes
+		uint16(24), // bit count
+		"MJPG",
+		uint32(a.width*a.heigh*3),
+		[4]uint32{}, // resolution and palette
+	); err != nil {
+		return err
+	}
+
+	if err := a.write("LIST"); err != nil {
+		return err
+	}
+	a.moviSize = a.offset
+	if err := a.write(uint32(0)); err != nil {
+		return err
+	}
+	a.movi = a.offset
+	return a.write("movi")
+}
+
+// writeChunk writes a 00dc chunk and adds it to the index. It
+// returns errAVIFull if the chunk and the index would not fit in the
+// file.
+func (a *aviWriter) writeChunk(data []byte) error {
+	size := a.offset + 8 + int64(len(data)+len(data)%2) +
+		8 + 16*int64(len(a.index)+1)
+	if size > aviMaxSize {
+		return errAVIFull
+	}
+	a.index = append(a.index, aviIndexEntry{
+		offset: uint32(a.offset - a.movi),
+		size:   uint32(len(data)),
+	})
+	if uint32(len(data)) > a.maxLen {
+		a.maxLen = uint32(len(data))
+	}
+	if err := a.write("00dc", uint32(len(data)), data); err != nil {
+		return err
+	}
+	if len(data)%2 == 1 {
+		return a.write(uint8(0))
+	}
+	return nil
+}
+
+// WriteFrame encodes the frame as JPEG and places it at the position
+// given by its timestamp.
+func (a *aviWriter) WriteFrame(frame *Frame) error {
+	timestamp := frame.Timestamp
+	if len(a.index) == 0 {
+		a.start = timestamp
+	}
+	position := int(math.Floor(timestamp.Sub(a.start).Seconds()*
+		float64(a.rate) + 0.5))
+	if position < len(a.index) {
+		return nil
+	}
+	if position-len(a.index) > aviMaxGap*a.rate {
+		// do not pad a long interruption: shift the timeline.
+		a.start = timestamp.Add(-time.Duration(len(a.index)) *
+			time.Second / time.Duration(a.rate))
+		position = len(a.index)
+	}
+	for len(a.index) < position {
+		if err := a.writeChunk(nil); err != nil {
+			return err
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, frame.Image(), &jpeg.Options{Quality: 90}); err != nil {
+		return err
+	}
+	return a.writeChunk(buf.Bytes())
+}
+
+// patch overwrites the value at position pos.
+func (a *aviWriter) patch(pos int64, value uint32) error {
+	if _, err := a.file.Seek(pos, io.SeekStart); err != nil {
+		return err
+	}
+	return binary.Write(a.file, binary.LittleEndian, value)
+}
+
+// Close writes the index, updates the headers and closes the file.
+func (a *aviWriter) Close() error {
+	err := a.finalize()
+	if closeErr := a.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (a *aviWriter) finalize() error {
+	moviEnd := a.offset
+	if err := a.write("idx1", uint32(16*len(a.index))); err != nil {
+		return err
+	}
+	for _, entry := range a.index {
+		if err := a.write("00dc", uint32(aviKeyFrame),
+			entry.offset, entry.size); err != nil {
+			return err
+		}
+	}
+	frames := uint32(len(a.index))
+	patches := []struct {
+		pos   int64
+		value uint32
+	}{
+		{a.riffSize, uint32(a.offset - 8)},
+		{a.maxBytes, a.maxLen * uint32(a.rate)},
+		{a.totalFrames, frames},
+		{a.bufferSize, a.maxLen},
+		{a.length, frames},
+		{a.moviSize, uint32(moviEnd - a.movi)},
+	}
+	for _, p := range patches {
+		if err := a.patch(p.pos, p.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
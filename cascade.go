@@ -0,0 +1,46 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/lugu/qiview/face"
+)
+
+// stringList is a flag which can be repeated.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+var (
+	cascadeFiles stringList
+	puplocFile   = ""
+	flpcDir      = ""
+)
+
+// loadCascades loads the cascade files or the embedded face cascade
+// if no file is given.
+func loadCascades(files []string) ([]*face.Cascade, error) {
+	if len(files) == 0 {
+		cascade, err := face.DefaultCascade()
+		if err != nil {
+			return nil, err
+		}
+		return []*face.Cascade{cascade}, nil
+	}
+	cascades := make([]*face.Cascade, len(files))
+	for i, file := range files {
+		cascade, err := face.LoadCascade(file)
+		if err != nil {
+			return nil, err
+		}
+		cascades[i] = cascade
+	}
+	return cascades, nil
+}
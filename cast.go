@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+var castFile = ""
+
+// castRecorder writes views as an asciicast v2 file which can be
+// played with asciinema.
+type castRecorder struct {
+	file         *os.File
+	out          *bufio.Writer
+	start        time.Time
+	width, heigh int
+}
+
+type castHeader struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+func newCastRecorder(filename string, width, heigh int) (*castRecorder, error) {
+	file, err := os.Create(filename)
+	if err != nil {
+		return nil, fmt.Errorf("create cast: %s", err)
+	}
+	c := &castRecorder{
+		file:  file,
+		out:   bufio.NewWriter(file),
+		start: time.Now(),
+		width: width,
+		heigh: heigh,
+	}
+	header, err := json.Marshal(castHeader{
+		Version:   2,
+		Width:     width,
+		Height:    heigh,
+		Timestamp: c.start.Unix(),
+		Title:     "qiview " + cameraName + " camera",
+		Env: map[string]string{
+			"TERM": os.Getenv("TERM"),
+		},
+	})
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	c.out.Write(header)
+	c.out.WriteByte('\n')
+	return c, nil
+}
+
+// event writes an event line: [time, code, data].
+func (c *castRecorder) event(code, data string) error {
+	elapsed := time.Since(c.start).Seconds()
+	line, err := json.Marshal([]interface{}{elapsed, code, data})
+	if err != nil {
+		return err
+	}
+	c.out.Write(line)
+	return c.out.WriteByte('\n')
+}
+
+// Record writes the view as an output event. A resize event is
+// written first if the view size has changed.
+func (c *castRecorder) Record(view *View) error {
+	if view.width != c.width || view.heigh != c.heigh {
+		c.width, c.heigh = view.width, view.heigh
+		size := fmt.Sprintf("%dx%d", c.width, c.heigh)
+		if err := c.event("r", size); err != nil {
+			return err
+		}
+	}
+
+	var buf bytes.Buffer
+	out := bufio.NewWriter(&buf)
+	for by := 0; by < view.heigh; by++ {
+		// Position the cursor on each line to avoid scrolling.
+		fmt.Fprintf(out, "\x1b[%d;1H", by+1)
+		view.writeANSILine(out, by)
+	}
+	out.Flush()
+	return c.event("o", buf.String())
+}
+
+// Close flushes the pending events and closes the file.
+func (c *castRecorder) Close() error {
+	if err := c.out.Flush(); err != nil {
+		c.file.Close()
+		return err
+	}
+	return c.file.Close()
+}
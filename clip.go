@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/nfnt/resize"
+)
+
+var (
+	clipSeconds = 5
+	clipWidth   = 320
+)
+
+// minGIFDelay is the shortest delay between two frames, in
+// hundredths of a second.
+const minGIFDelay = 2
+
+// medianCut is a draw.Quantizer which splits the color space into
+// boxes holding the same number of pixels.
+type medianCut struct{}
+
+// Quantize appends to p the average colors of the boxes.
+func (medianCut) Quantize(p color.Palette, m image.Image) color.Palette {
+	bounds := m.Bounds()
+	pixels := make([][3]uint8, 0, bounds.Dx()*bounds.Dy())
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, _ := m.At(x, y).RGBA()
+			pixels = append(pixels, [3]uint8{
+				uint8(r >> 8), uint8(g >> 8), uint8(b >> 8),
+			})
+		}
+	}
+	if len(pixels) == 0 {
+		return p
+	}
+	boxes := [][][3]uint8{pixels}
+	for len(p)+len(boxes) < cap(p) {
+		// split the box with the widest channel range.
+		best, channel, width := -1, 0, 0
+		for i, box := range boxes {
+			if len(box) < 2 {
+				continue
+			}
+			c, w := widestChannel(box)
+			if w > width {
+				best, channel, width = i, c, w
+			}
+		}
+		if best < 0 {
+			break
+		}
+		box := boxes[best]
+		sort.Slice(box, func(i, j int) bool {
+			return box[i][channel] < box[j][channel]
+		})
+		median := len(box) / 2
+		boxes[best] = box[:median]
+		boxes = append(boxes, box[median:])
+	}
+	for _, box := range boxes {
+		var sum [3]int
+		for _, pixel := range box {
+			for c := range sum {
+				sum[c] += int(pixel[c])
+			}
+		}
+		p = append(p, color.RGBA{
+			uint8(sum[0] / len(box)),
+			uint8(sum[1] / len(box)),
+			uint8(sum[2] / len(box)),
+			0xff,
+		})
+	}
+	return p
+}
+
+// widestChannel returns the channel with the largest range of values
+// and this range.
+func widestChannel(box [][3]uint8) (int, int) {
+	min := [3]uint8{255, 255, 255}
+	max := [3]uint8{0, 0, 0}
+	for _, pixel := range box {
+		for c := range pixel {
+			if pixel[c] < min[c] {
+				min[c] = pixel[c]
+			}
+			if pixel[c] > max[c] {
+				max[c] = pixel[c]
+			}
+		}
+	}
+	channel, width := 0, 0
+	for c := range min {
+		if int(max[c])-int(min[c]) > width {
+			channel, width = c, int(max[c])-int(min[c])
+		}
+	}
+	return channel, width
+}
+
+// writeGIF writes the frames as an animated GIF scaled to width
+// pixels. The delays are taken from the frame timestamps.
+func writeGIF(filename string, frames []*Frame, width int) error {
+	if len(frames) == 0 {
+		return fmt.Errorf("no frame to export")
+	}
+	anim := &gif.GIF{}
+	for i, frame := range frames {
+		img := resize.Resize(uint(width), 0, frame.Image(), resize.Bilinear)
+		palette := medianCut{}.Quantize(make(color.Palette, 0, 256), img)
+		paletted := image.NewPaletted(img.Bounds(), palette)
+		draw.FloydSteinberg.Draw(paletted, img.Bounds(), img, img.Bounds().Min)
+
+		delay := time.Second / time.Duration(fps)
+		if i+1 < len(frames) {
+			delay = frames[i+1].Timestamp.Sub(frame.Timestamp)
+		}
+		anim.Image = append(anim.Image, paletted)
+		// most decoders play shorter delays at 100 ms.
+		anim.Delay = append(anim.Delay,
+			clampInt(int(delay/(10*time.Millisecond)), minGIFDelay, math.MaxInt32))
+	}
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("create gif: %s", err)
+	}
+	if err := gif.EncodeAll(file, anim); err != nil {
+		file.Close()
+		return fmt.Errorf("write gif: %s", err)
+	}
+	return file.Close()
+}
+
+// exportClip writes the last clipSeconds of the history in the
+// background and reports the result in the viewer.
+func exportClip() {
+	frames := history.Last(time.Duration(clipSeconds) * time.Second)
+	filename := filepath.Join(snapshotDir, fmt.Sprintf("qiview-%s-%s.gif",
+		cameraName, time.Now().Format("20060102-150405")))
+	notify("exporting %s", filename)
+	go func() {
+		if err := writeGIF(filename, frames, clipWidth); err != nil {
+			notify("clip: %s", err)
+			return
+		}
+		notify("saved %s", filename)
+	}()
+}
+
+// captureClip records clipSeconds of frames and writes them into
+// filename.
+func captureClip(filename string) error {
+	var frames []*Frame
+	deadline := time.Now().Add(time.Duration(clipSeconds) * time.Second)
+	for time.Now().Before(deadline) {
+		start := time.Now()
+		frame, err := nextFrame()
+		if err != nil {
+			return err
+		}
+		frames = append(frames, frame)
+		time.Sleep(time.Second/time.Duration(fps) - time.Since(start))
+	}
+	return writeGIF(filename, frames, clipWidth)
+}
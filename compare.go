@@ -0,0 +1,198 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+
+	"github.com/lugu/qiloop/app"
+	"github.com/lugu/qiview/face"
+	"github.com/nfnt/resize"
+)
+
+const (
+	compareSideBySide = iota
+	comparePIP
+	compareDifference
+	compareModes
+)
+
+var (
+	compareURL    = ""
+	compareReplay = ""
+	compareMode   = compareSideBySide
+
+	// compareSource is nil unless a second source is displayed. Its
+	// frames are kept in compareHistory in sync with history.
+	compareSource  frameSource
+	compareHistory *frameRing
+	// compareTracker follows the faces of the second source in
+	// privacy mode.
+	compareTracker *face.Tracker
+)
+
+// openCompareSource opens the second source given on the command
+// line, if any.
+func openCompareSource(camera int) (frameSource, error) {
+	if compareReplay != "" {
+		return openReplay(compareReplay, replayRealtime)
+	}
+	if compareURL == "" {
+		return nil, nil
+	}
+	// connect with the credentials of the main robot (-user and
+	// -token) by changing the address used by app.SessionFromFlag.
+	mainURL := robotURL()
+	if err := flag.Set("qi-url", compareURL); err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %s", compareURL, err)
+	}
+	sess, err := app.SessionFromFlag()
+	flag.Set("qi-url", mainURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %s", compareURL, err)
+	}
+	videoDevice, err := ALVideoDevice(sess)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create video device: %s", err)
+	}
+	return subscribe(videoDevice, camera)
+}
+
+// nextCompareImage returns the image of the second source matching
+// the displayed frame.
+func nextCompareImage() (*imageRGB, error) {
+	frame, err := compareSource.Next()
+	if err != nil {
+		return nil, fmt.Errorf("second source: %s", err)
+	}
+	if privacyMode != "" {
+		frame = anonymizeCompare(frame)
+	}
+	frame = applyMasks(frame)
+	compareHistory.Push(frame)
+	if paused && comparePaused != nil {
+		frame = comparePaused
+	}
+	return frame.Image(), nil
+}
+
+// compose combines the image of the main source with the image of
+// the second source according to compareMode.
+func compose(first, second *imageRGB) *imageRGB {
+	switch compareMode {
+	case comparePIP:
+		return pictureInPicture(first, second)
+	case compareDifference:
+		return difference(first, second)
+	}
+	return sideBySide(first, second)
+}
+
+// scaled returns img resized to width x heigh.
+func scaled(img *imageRGB, width, heigh int) image.Image {
+	if img.width == width && img.heigh == heigh {
+		return img
+	}
+	return resize.Resize(uint(width), uint(heigh), img, resize.Bilinear)
+}
+
+func newImageRGB(width, heigh int) *imageRGB {
+	return &imageRGB{
+		width:  width,
+		heigh:  heigh,
+		pixels: make([]byte, width*heigh*3),
+	}
+}
+
+// paste draws src on dst at (x, y).
+func paste(dst *imageRGB, src image.Image, x, y int) {
+	bounds := src.Bounds()
+	for sy := bounds.Min.Y; sy < bounds.Max.Y; sy++ {
+		for sx := bounds.Min.X; sx < bounds.Max.X; sx++ {
+			dst.Set(x+sx-bounds.Min.X, y+sy-bounds.Min.Y, src.At(sx, sy))
+		}
+	}
+}
+
+// sideBySide places the second image, scaled to the same size, on
+// the right of the main image.
+func sideBySide(first, second *imageRGB) *imageRGB {
+	img := newImageRGB(2*first.width, first.heigh)
+	paste(img, first, 0, 0)
+	paste(img, scaled(second, first.width, first.heigh), first.width, 0)
+	return img
+}
+
+// pictureInPicture places the second image, scaled to a quarter of
+// the width, in the bottom right corner of the main image.
+func pictureInPicture(first, second *imageRGB) *imageRGB {
+	const margin = 4
+	img := first.Clone()
+	width := first.width / 4
+	heigh := first.heigh / 4
+	if width == 0 || heigh == 0 {
+		return img
+	}
+	x := first.width - width - margin
+	y := first.heigh - heigh - margin
+	border := color.RGBA{0xff, 0xff, 0xff, 0xff}
+	for i := x - 1; i <= x+width; i++ {
+		img.Set(i, y-1, border)
+		img.Set(i, y+heigh, border)
+	}
+	for j := y - 1; j <= y+heigh; j++ {
+		img.Set(x-1, j, border)
+		img.Set(x+width, j, border)
+	}
+	paste(img, scaled(second, width, heigh), x, y)
+	return img
+}
+
+// difference returns the absolute difference of each channel.
+func difference(first, second *imageRGB) *imageRGB {
+	img := newImageRGB(first.width, first.heigh)
+	other := scaled(second, first.width, first.heigh)
+	for y := 0; y < first.heigh; y++ {
+		for x := 0; x < first.width; x++ {
+			r1, g1, b1, _ := first.At(x, y).RGBA()
+			r2, g2, b2, _ := other.At(x, y).RGBA()
+			img.Set(x, y, color.RGBA64{
+				absDiff(r1, r2), absDiff(g1, g2), absDiff(b1, b2), 0xffff,
+			})
+		}
+	}
+	return img
+}
+
+func absDiff(a, b uint32) uint16 {
+	if a > b {
+		return uint16(a - b)
+	}
+	return uint16(b - a)
+}
+
+// displayRegions returns where the frames are displayed in an image
+// of the given bounds: the two halves when the sources are side by
+// side.
+func displayRegions(bounds image.Rectangle) []image.Rectangle {
+	if compareSource == nil || compareMode != compareSideBySide {
+		return []image.Rectangle{bounds}
+	}
+	middle := bounds.Min.X + bounds.Dx()/2
+	return []image.Rectangle{
+		image.Rect(bounds.Min.X, bounds.Min.Y, middle, bounds.Max.Y),
+		image.Rect(middle, bounds.Min.Y, bounds.Max.X, bounds.Max.Y),
+	}
+}
+
+// nextCompareMode cycles through the comparison modes.
+func nextCompareMode() {
+	if compareSource == nil {
+		notify("no second source (see -compare-url and -compare-replay)")
+		return
+	}
+	compareMode = (compareMode + 1) % compareModes
+	notify("%s", []string{"side by side", "picture in picture",
+		"difference"}[compareMode])
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lugu/qiview/face"
+)
+
+var (
+	// faceFPS is the rate of the face detection, zero to detect as
+	// fast as possible.
+	faceFPS = 5
+	// syncDetection detects the faces of every frame before it is
+	// used instead of in the background. The outputs which must not
+	// miss a detection use it.
+	syncDetection = false
+
+	// the faces are searched from -faceSweep to faceSweep degrees
+	// around cameraRoll.
+	faceSweep     = 0.0
+	faceSweepStep = 15.0
+	cameraRoll    = 0.0
+)
+
+var (
+	// detectorMutex protects detector.Params which are changed by
+	// the user interface while the worker detects.
+	detectorMutex sync.Mutex
+
+	// the worker processes pendingFrame and publishes detectedFaces,
+	// found in the frame captured at detectedTime.
+	detectionMutex   sync.Mutex
+	pendingFrame     *Frame
+	pendingTime      time.Time
+	detectedFaces    []face.Detection
+	detectedTime     time.Time
+	detectionLatency time.Duration
+	detectionWake    = make(chan struct{}, 1)
+)
+
+// submitDetection asks the worker to process frame. A frame which
+// was not processed yet is replaced.
+func submitDetection(frame *Frame) {
+	detectionMutex.Lock()
+	pendingFrame, pendingTime = frame, time.Now()
+	detectionMutex.Unlock()
+	select {
+	case detectionWake <- struct{}{}:
+	default:
+	}
+}
+
+// lastDetections returns the most recent faces found by the worker
+// and the timestamp of the frame they were found in.
+func lastDetections() ([]face.Detection, time.Time) {
+	detectionMutex.Lock()
+	defer detectionMutex.Unlock()
+	return detectedFaces, detectedTime
+}
+
+// findFaces detects the faces of frame and tracks them with t if not
+// nil.
+func findFaces(frame *Frame, t *face.Tracker) []face.Detection {
+	detectorMutex.Lock()
+	d := *detector
+	detectorMutex.Unlock()
+	faces := d.Detect(frame.Image())
+	if t != nil {
+		faces = t.Update(faces, frame.Timestamp)
+	}
+	return faces
+}
+
+// detect finds and tracks the faces of frame, submitted at the given
+// time, and publishes them.
+func detect(frame *Frame, submitted time.Time) []face.Detection {
+	faces := findFaces(frame, tracker)
+
+	detectionMutex.Lock()
+	detectedFaces, detectedTime = faces, frame.Timestamp
+	detectionLatency = time.Since(submitted)
+	detectionMutex.Unlock()
+	writeDetections(frame, faces)
+	updateGallery(frame, faces)
+	updateStats(frame, faces)
+	return faces
+}
+
+// detectionWorker runs the face detection on the latest submitted
+// frame, at most faceFPS times per second.
+func detectionWorker() {
+	for range detectionWake {
+		start := time.Now()
+		detectionMutex.Lock()
+		frame, submitted := pendingFrame, pendingTime
+		pendingFrame = nil
+		detectionMutex.Unlock()
+		if frame == nil {
+			continue
+		}
+
+		detect(frame, submitted)
+		if faceFPS > 0 {
+			time.Sleep(time.Second/time.Duration(faceFPS) - time.Since(start))
+		}
+	}
+}
+
+// detectionText describes the delay between the submission of a
+// frame and its detection result.
+func detectionText() string {
+	detectionMutex.Lock()
+	defer detectionMutex.Unlock()
+	return fmt.Sprintf("latency=%dms", detectionLatency.Milliseconds())
+}
+
+// sweepAngles returns the angles at which the faces are searched.
+func sweepAngles(sweep, step, roll float64) []float64 {
+	if sweep <= 0 || step <= 0 {
+		if roll == 0 {
+			return nil
+		}
+		return []float64{roll}
+	}
+	n := int(sweep / step)
+	angles := make([]float64, 0, 2*n+1)
+	for i := -n; i <= n; i++ {
+		angles = append(angles, roll+float64(i)*step)
+	}
+	return angles
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"time"
+)
+
+var (
+	dumpFrames = 0
+	dumpFormat = "ansi"
+	dumpWidth  = 80
+)
+
+// checkDump rejects the formats which can not hold dumpFrames frames
+// in a single stream: PNG files can not be concatenated.
+func checkDump() error {
+	if dumpFormat == "png" && dumpFrames > 1 {
+		return fmt.Errorf("-dump-format png writes a single frame, use ppm for %d frames", dumpFrames)
+	}
+	return nil
+}
+
+// dump writes dumpFrames frames to w using dumpFormat and returns.
+func dump(w io.Writer) error {
+
+	var write func(io.Writer, image.Image) error
+	var recorder *htmlRecorder
+	switch dumpFormat {
+	case "ansi":
+		write = func(w io.Writer, img image.Image) error {
+			return textView(img).WriteANSI(w)
+		}
+	case "ascii":
+		write = func(w io.Writer, img image.Image) error {
+			return textView(img).WriteText(w)
+		}
+	case "png":
+		write = png.Encode
+	case "ppm":
+		write = writePPM
+	case "html":
+		// frames are written to a single page.
+		recorder = newHTMLRecorder(w)
+		write = func(w io.Writer, img image.Image) error {
+			recorder.Record(textView(img))
+			return nil
+		}
+	default:
+		return fmt.Errorf("invalid dump format: %s", dumpFormat)
+	}
+
+	for i := 0; i < dumpFrames; i++ {
+		if i != 0 {
+			time.Sleep((1000 / time.Duration(fps)) * time.Millisecond)
+		}
+		image, err := getImage()
+		if err != nil {
+			return err
+		}
+		if err := write(w, image); err != nil {
+			return fmt.Errorf("write frame %d: %s", i, err)
+		}
+	}
+	if recorder != nil {
+		return recorder.Close()
+	}
+	return nil
+}
+
+// textView renders img dumpWidth characters wide. Terminal characters
+// are about twice as tall as wide, so the height is halved to keep the
+// aspect ratio.
+func textView(img image.Image) *View {
+	size := img.Bounds().Size()
+	heigh := dumpWidth * size.Y / size.X / 2
+	if heigh < 1 {
+		heigh = 1
+	}
+	return newView(img, dumpWidth, heigh)
+}
+
+// writePPM writes img as a binary portable pixmap (P6).
+func writePPM(w io.Writer, img image.Image) error {
+	out := bufio.NewWriter(w)
+	bounds := img.Bounds()
+	fmt.Fprintf(out, "P6\n%d %d\n255\n", bounds.Dx(), bounds.Dy())
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, _ := img.At(x, y).RGBA()
+			out.Write([]byte{byte(r >> 8), byte(g >> 8), byte(b >> 8)})
+		}
+	}
+	return out.Flush()
+}
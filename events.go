@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/lugu/qiview/face"
+)
+
+// detectionsFile receives a JSON object per processed frame.
+var detectionsFile = ""
+
+// detectionEvent is a line of the detections file.
+type detectionEvent struct {
+	Timestamp  time.Time        `json:"timestamp"`
+	Camera     string           `json:"camera"`
+	CameraID   int              `json:"camera_id"`
+	Width      int              `json:"width"`
+	Height     int              `json:"height"`
+	Detections []face.Detection `json:"detections"`
+}
+
+var (
+	eventsMutex   sync.Mutex
+	eventsFile    *os.File
+	eventsEncoder *json.Encoder
+	eventsLast    time.Time
+)
+
+// openDetectionsOut creates the detections file.
+func openDetectionsOut(file string) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return fmt.Errorf("detections output: %s", err)
+	}
+	eventsMutex.Lock()
+	defer eventsMutex.Unlock()
+	eventsFile, eventsEncoder = f, json.NewEncoder(f)
+	return nil
+}
+
+// writeDetections writes the faces found in frame. The timestamps of
+// the file only increase: a frame which is not more recent than the
+// last one written, for example while paused, after a rewind or when
+// a replay loops, is skipped.
+func writeDetections(frame *Frame, faces []face.Detection) {
+	eventsMutex.Lock()
+	defer eventsMutex.Unlock()
+	if eventsEncoder == nil || !frame.Timestamp.After(eventsLast) {
+		return
+	}
+	eventsLast = frame.Timestamp
+	if faces == nil {
+		faces = []face.Detection{}
+	}
+	err := eventsEncoder.Encode(detectionEvent{
+		Timestamp:  frame.Timestamp,
+		Camera:     cameraIDName(frame.Camera),
+		CameraID:   frame.Camera,
+		Width:      frame.Width,
+		Height:     frame.Height,
+		Detections: faces,
+	})
+	if err != nil {
+		notify("detections output: %s", err)
+		eventsFile.Close()
+		eventsFile, eventsEncoder = nil, nil
+	}
+}
+
+// closeDetectionsOut closes the detections file if it is open.
+func closeDetectionsOut() error {
+	eventsMutex.Lock()
+	defer eventsMutex.Unlock()
+	if eventsFile == nil {
+		return nil
+	}
+	err := eventsFile.Close()
+	eventsFile, eventsEncoder = nil, nil
+	return err
+}
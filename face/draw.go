@@ -0,0 +1,110 @@
+package face
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"strconv"
+)
+
+// digits is a 3x5 font: each row is 3 bits, the highest bit on the
+// left.
+var digits = [10][5]uint8{
+	{7, 5, 5, 5, 7}, // 0
+	{2, 6, 2, 2, 7}, // 1
+	{7, 1, 7, 4, 7}, // 2
+	{7, 1, 3, 1, 7}, // 3
+	{5, 5, 7, 1, 1}, // 4
+	{7, 4, 7, 1, 7}, // 5
+	{7, 4, 7, 5, 7}, // 6
+	{7, 1, 2, 2, 2}, // 7
+	{7, 5, 7, 5, 7}, // 8
+	{7, 5, 7, 1, 7}, // 9
+}
+
+// drawNumber writes n with its top left corner at (x, y). Each dot
+// of the font is a square of scale pixels.
+func drawNumber(img draw.Image, x, y, n, scale int, col color.Color) {
+	text := strconv.Itoa(n)
+	for i, c := range text {
+		glyph := digits[c-'0']
+		for row, bits := range glyph {
+			for column := 0; column < 3; column++ {
+				if bits&(4>>uint(column)) == 0 {
+					continue
+				}
+				px := x + (4*i+column)*scale
+				py := y + row*scale
+				for dy := 0; dy < scale; dy++ {
+					for dx := 0; dx < scale; dx++ {
+						img.Set(px+dx, py+dy, col)
+					}
+				}
+			}
+		}
+	}
+}
+
+// Draw draws a rectangle around each detection, with its track ID
+// if the face is tracked. Predicted boxes are drawn in orange.
+func Draw(img draw.Image, detections []Detection) {
+	col := color.RGBA{0, 255, 0, 255} // Green
+
+	// hLine draws a horizontal line
+	hLine := func(x1, y, x2 int) {
+		for ; x1 <= x2; x1++ {
+			img.Set(x1, y, col)
+		}
+	}
+
+	// vLine draws a veritcal line
+	vLine := func(x, y1, y2 int) {
+		for ; y1 <= y2; y1++ {
+			img.Set(x, y1, col)
+		}
+	}
+
+	// rect draws a rectangle utilizing HLine() and VLine()
+	rect := func(x1, y1, x2, y2 int) {
+		hLine(x1, y1, x2)
+		hLine(x1, y2, x2)
+		vLine(x1, y1, y2)
+		vLine(x2, y1, y2)
+	}
+
+	// cross draws a small cross centered on p
+	cross := func(p image.Point, size int, c color.Color) {
+		for i := -size; i <= size; i++ {
+			img.Set(p.X+i, p.Y, c)
+			img.Set(p.X, p.Y+i, c)
+		}
+	}
+
+	pupil := color.RGBA{255, 0, 0, 255}      // Red
+	landmark := color.RGBA{255, 255, 0, 255} // Yellow
+
+	detected := col
+	predicted := color.RGBA{255, 160, 0, 255} // Orange
+
+	for _, d := range detections {
+		col = detected
+		if d.Predicted {
+			col = predicted
+		}
+		rect(d.Box.Min.X, d.Box.Min.Y, d.Box.Max.X, d.Box.Max.Y)
+		if d.Track != 0 {
+			// above the box, larger for large faces.
+			scale := 1 + d.Box.Dx()/100
+			drawNumber(img, d.Box.Min.X, d.Box.Min.Y-6*scale,
+				d.Track, scale, col)
+		}
+		for _, eye := range []*image.Point{d.LeftEye, d.RightEye} {
+			if eye != nil {
+				cross(*eye, 2, pupil)
+			}
+		}
+		for _, p := range d.Landmarks {
+			cross(p, 1, landmark)
+		}
+	}
+}
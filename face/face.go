@@ -1,51 +1,193 @@
+// Package face detects faces using the pigo cascade classifier.
 package face
 
 import (
-	"image/color"
-	"image/draw"
+	"fmt"
+	"image"
 	_ "image/jpeg"
 	"io/ioutil"
-	"log"
+	"math"
+	"path/filepath"
+	"sort"
+	"sync"
 
 	pigo "github.com/esimov/pigo/core"
 	"github.com/markbates/pkger"
 )
 
+// Cascade is a pigo classifier.
+type Cascade struct {
+	Name       string
+	classifier *pigo.Pigo
+}
+
 var (
-	classifier *pigo.Pigo = nil
+	defaultCascade     *Cascade
+	defaultCascadeErr  error
+	defaultCascadeOnce sync.Once
 )
 
-func loadClassifier() {
-	model, err := pkger.Open("/face/facefinder")
+// UnpackCascade parses the content of a pigo cascade file.
+func UnpackCascade(name string, data []byte) (*Cascade, error) {
+	classifier, err := pigo.NewPigo().Unpack(data)
 	if err != nil {
-		log.Fatalf("Error reading the cascade file: %v", err)
+		return nil, fmt.Errorf("unpack cascade %s: %s", name, err)
 	}
-	cascadeFile, err := ioutil.ReadAll(model)
+	return &Cascade{
+		Name:       name,
+		classifier: classifier,
+	}, nil
+}
+
+// LoadCascade reads a pigo cascade file. The cascade is named after
+// the file.
+func LoadCascade(path string) (*Cascade, error) {
+	data, err := ioutil.ReadFile(path)
 	if err != nil {
-		log.Fatalf("Error reading the cascade file: %v", err)
+		return nil, fmt.Errorf("read cascade: %s", err)
 	}
-	p := pigo.NewPigo()
-	classifier, err = p.Unpack(cascadeFile)
-	if err != nil {
-		log.Fatalf("Error reading the cascade file: %s", err)
+	return UnpackCascade(filepath.Base(path), data)
+}
+
+// DefaultCascade returns the embedded face cascade. It is loaded
+// once.
+func DefaultCascade() (*Cascade, error) {
+	defaultCascadeOnce.Do(func() {
+		model, err := pkger.Open("/face/facefinder")
+		if err != nil {
+			defaultCascadeErr = fmt.Errorf("open cascade: %s", err)
+			return
+		}
+		defer model.Close()
+		data, err := ioutil.ReadAll(model)
+		if err != nil {
+			defaultCascadeErr = fmt.Errorf("read cascade: %s", err)
+			return
+		}
+		defaultCascade, defaultCascadeErr = UnpackCascade("facefinder", data)
+	})
+	return defaultCascade, defaultCascadeErr
+}
+
+// Detection is a face found in an image.
+type Detection struct {
+	// Box is the bounding box of the face.
+	Box image.Rectangle `json:"box"`
+	// Score is the confidence of the classifier.
+	Score float32 `json:"score"`
+	// Scale is the size in pixels of the face.
+	Scale int `json:"scale"`
+	// Cascade is the name of the cascade which found the face.
+	Cascade string `json:"cascade"`
+	// Angle is the rotation in degrees at which the face was found.
+	Angle float64 `json:"angle,omitempty"`
+	// LeftEye and RightEye are the pupils, nil if not located.
+	LeftEye  *image.Point `json:"left_eye,omitempty"`
+	RightEye *image.Point `json:"right_eye,omitempty"`
+	// Landmarks are the facial landmark points.
+	Landmarks []image.Point `json:"landmarks,omitempty"`
+	// Track identifies the face across frames, zero if the face is
+	// not tracked.
+	Track int `json:"track,omitempty"`
+	// Predicted is true when the face was not detected in this frame
+	// and its box is the position predicted by the tracker.
+	Predicted bool `json:"predicted,omitempty"`
+	// Detected is the box found by the detector when Box is smoothed
+	// by the tracker. It is empty for predicted faces and when the
+	// faces are not tracked.
+	Detected image.Rectangle `json:"-"`
+}
+
+// Center returns the center of the face.
+func (d Detection) Center() image.Point {
+	return image.Point{
+		X: (d.Box.Min.X + d.Box.Max.X) / 2,
+		Y: (d.Box.Min.Y + d.Box.Max.Y) / 2,
 	}
 }
 
-// Draw detects faces draw rectangles around them.
-func Draw(img draw.Image) {
+// Params configures the detection.
+type Params struct {
+	// MinSize and MaxSize bound the size in pixels of the faces.
+	MinSize int
+	MaxSize int
+	// ShiftFactor is the step of the sliding window relatively to
+	// its size.
+	ShiftFactor float64
+	// ScaleFactor is the ratio between two window sizes.
+	ScaleFactor float64
+	// IoUThreshold is the overlap above which two detections are
+	// merged.
+	IoUThreshold float64
+	// QThreshold is the minimum score of a detection.
+	QThreshold float32
+	// Angles are the rotations in degrees at which the faces are
+	// searched. No angle means upright faces only.
+	Angles []float64
+}
 
-	if classifier == nil {
-		loadClassifier()
+// Validate reports the parameters which would prevent the detection
+// from ending: the window must grow at each scale.
+func (p Params) Validate() error {
+	if p.MinSize < 1 {
+		return fmt.Errorf("minimum face size must be at least 1: %d", p.MinSize)
+	}
+	if p.MaxSize < p.MinSize {
+		return fmt.Errorf("maximum face size (%d) below the minimum (%d)",
+			p.MaxSize, p.MinSize)
+	}
+	if p.ScaleFactor <= 1 {
+		return fmt.Errorf("scale factor must be greater than 1: %g", p.ScaleFactor)
+	}
+	if int(float64(p.MinSize)*p.ScaleFactor) <= p.MinSize {
+		return fmt.Errorf("scale factor %g does not grow the minimum size %d",
+			p.ScaleFactor, p.MinSize)
+	}
+	if p.ShiftFactor <= 0 {
+		return fmt.Errorf("shift factor must be positive: %g", p.ShiftFactor)
 	}
+	return nil
+}
+
+// DefaultParams works for faces close to the camera.
+var DefaultParams = Params{
+	MinSize:      20,
+	MaxSize:      1000,
+	ShiftFactor:  0.1,
+	ScaleFactor:  1.1,
+	IoUThreshold: 0.2,
+	QThreshold:   5.0,
+}
+
+// Detector runs face classifiers over images.
+type Detector struct {
+	cascades []*Cascade
+	Params   Params
+	// Landmarks locates the pupils and the landmarks of the faces
+	// if not nil.
+	Landmarks *LandmarkDetector
+}
+
+// NewDetector returns a detector using the given cascades. The
+// detections of each cascade are reported separately.
+func NewDetector(params Params, cascades ...*Cascade) *Detector {
+	return &Detector{
+		cascades: cascades,
+		Params:   params,
+	}
+}
+
+// Detect returns the faces found in img. The image is not modified.
+func (d *Detector) Detect(img image.Image) []Detection {
 
 	src := pigo.ImgToNRGBA(img)
 	pixels := pigo.RgbToGrayscale(src)
 	cols, rows := src.Bounds().Max.X, src.Bounds().Max.Y
 	cParams := pigo.CascadeParams{
-		MinSize:     20,
-		MaxSize:     1000,
-		ShiftFactor: 0.1,
-		ScaleFactor: 1.1,
+		MinSize:     d.Params.MinSize,
+		MaxSize:     d.Params.MaxSize,
+		ShiftFactor: d.Params.ShiftFactor,
+		ScaleFactor: d.Params.ScaleFactor,
 		ImageParams: pigo.ImageParams{
 			Pixels: pixels,
 			Rows:   rows,
@@ -54,55 +196,101 @@ func Draw(img draw.Image) {
 		},
 	}
 
-	// Run the classifier over the obtained leaf nodes and return the detection results.
-	// The result contains quadruplets representing the row, column, scale and detection score.
-	angle := 0.0
-	dets := classifier.RunCascade(cParams, angle)
-
-	// Calculate the intersection over union (IoU) of two clusters.
-	iouThreshold := 0.2
-	faces := classifier.ClusterDetections(dets, iouThreshold)
-
-	drawRectangles(img, faces)
+	angles := uniqueAngles(d.Params.Angles)
+	var detections []Detection
+	for _, cascade := range d.cascades {
+		var found []Detection
+		for _, angle := range angles {
+			found = append(found, d.run(cascade, cParams, angle)...)
+		}
+		if len(angles) > 1 {
+			// the same face is often found at neighbor angles.
+			found = merge(found, d.Params.IoUThreshold)
+		}
+		detections = append(detections, found...)
+	}
+	return detections
 }
 
-// Draw a rectangle for each detection.
-func drawRectangles(img draw.Image, faces []pigo.Detection) {
-	col := color.RGBA{0, 255, 0, 255} // Green
+// pigoAngle converts an angle in degrees into a fraction of a turn
+// between 0 and 1 as expected by pigo, which does not rotate for
+// negative angles.
+func pigoAngle(degrees float64) float64 {
+	return math.Mod(math.Mod(degrees, 360)+360, 360) / 360
+}
 
-	// hLine draws a horizontal line
-	hLine := func(x1, y, x2 int) {
-		for ; x1 <= x2; x1++ {
-			img.Set(x1, y, col)
+// uniqueAngles returns the angles without the duplicates once
+// normalized, or the upright angle if there is none.
+func uniqueAngles(angles []float64) []float64 {
+	if len(angles) == 0 {
+		return []float64{0}
+	}
+	seen := map[float64]bool{}
+	var unique []float64
+	for _, angle := range angles {
+		if a := pigoAngle(angle); !seen[a] {
+			seen[a] = true
+			unique = append(unique, angle)
 		}
 	}
+	return unique
+}
 
-	// vLine draws a veritcal line
-	vLine := func(x, y1, y2 int) {
-		for ; y1 <= y2; y1++ {
-			img.Set(x, y1, col)
+// merge keeps the best scoring detection of each group of detections
+// overlapping more than threshold.
+func merge(detections []Detection, threshold float64) []Detection {
+	sort.SliceStable(detections, func(i, j int) bool {
+		return detections[i].Score > detections[j].Score
+	})
+	var merged []Detection
+	for _, candidate := range detections {
+		overlap := false
+		for _, kept := range merged {
+			if iou(candidate.Box, kept.Box) > threshold {
+				overlap = true
+				break
+			}
+		}
+		if !overlap {
+			merged = append(merged, candidate)
 		}
 	}
+	return merged
+}
 
-	// rect draws a rectangle utilizing HLine() and VLine()
-	rect := func(x1, y1, x2, y2 int) {
-		hLine(x1, y1, x2)
-		hLine(x1, y2, x2)
-		vLine(x1, y1, y2)
-		vLine(x2, y1, y2)
-	}
+// run detects the faces rotated by angle degrees.
+func (d *Detector) run(cascade *Cascade, cParams pigo.CascadeParams,
+	angle float64) []Detection {
+	// Run the classifier over the obtained leaf nodes and return the detection results.
+	// The result contains quadruplets representing the row, column, scale and detection score.
+	dets := cascade.classifier.RunCascade(cParams, pigoAngle(angle))
+
+	// Calculate the intersection over union (IoU) of two clusters.
+	faces := cascade.classifier.ClusterDetections(dets, d.Params.IoUThreshold)
 
-	var qThresh float32 = 5.0
+	var detections []Detection
 
 	for _, face := range faces {
-		if face.Q <= qThresh {
+		if face.Q <= d.Params.QThreshold {
 			continue
 		}
-		rect(
-			face.Col-face.Scale/2,
-			face.Row-face.Scale/2,
-			face.Col-face.Scale/2+face.Scale,
-			face.Row-face.Scale/2+face.Scale,
-		)
+		detection := Detection{
+			Box: image.Rect(
+				face.Col-face.Scale/2,
+				face.Row-face.Scale/2,
+				face.Col-face.Scale/2+face.Scale,
+				face.Row-face.Scale/2+face.Scale,
+			),
+			Score:   face.Q,
+			Scale:   face.Scale,
+			Cascade: cascade.Name,
+			Angle:   angle,
+		}
+		if d.Landmarks != nil {
+			d.Landmarks.locate(&detection, face.Row, face.Col,
+				face.Scale, angle, cParams.ImageParams)
+		}
+		detections = append(detections, detection)
 	}
+	return detections
 }
@@ -0,0 +1,110 @@
+package face
+
+import (
+	"fmt"
+	"image"
+	"io/ioutil"
+
+	pigo "github.com/esimov/pigo/core"
+)
+
+var (
+	// eyeCascades locate points around the eyes, they are run on
+	// both sides of the face.
+	eyeCascades = []string{"lp46", "lp44", "lp42", "lp38", "lp312"}
+	// mouthCascades locate points around the mouth.
+	mouthCascades = []string{"lp93", "lp84", "lp82", "lp81"}
+)
+
+// perturbs is the number of random perturbations of each search.
+const perturbs = 63
+
+// LandmarkDetector locates the pupils and the facial landmarks inside
+// the detected faces.
+type LandmarkDetector struct {
+	puploc *pigo.PuplocCascade
+	// flpcs is nil when only the pupils are located.
+	flpcs map[string][]*pigo.FlpCascade
+}
+
+// NewLandmarkDetector loads the pupil localization cascade (puploc)
+// and, if flpcDir is not empty, the facial landmark cascades found in
+// this directory.
+func NewLandmarkDetector(puplocFile, flpcDir string) (*LandmarkDetector, error) {
+	data, err := ioutil.ReadFile(puplocFile)
+	if err != nil {
+		return nil, fmt.Errorf("read puploc cascade: %s", err)
+	}
+	p := pigo.NewPuplocCascade()
+	puploc, err := p.UnpackCascade(data)
+	if err != nil {
+		return nil, fmt.Errorf("unpack puploc cascade: %s", err)
+	}
+	l := &LandmarkDetector{
+		puploc: puploc,
+	}
+	if flpcDir == "" {
+		return l, nil
+	}
+	l.flpcs, err = puploc.ReadCascadeDir(flpcDir)
+	if err != nil {
+		return nil, fmt.Errorf("read landmark cascades: %s", err)
+	}
+	return l, nil
+}
+
+func found(p *pigo.Puploc) bool {
+	return p != nil && p.Row > 0 && p.Col > 0
+}
+
+func point(p *pigo.Puploc) *image.Point {
+	return &image.Point{X: p.Col, Y: p.Row}
+}
+
+// locate fills the eyes and the landmarks of a detection centered on
+// (row, col) and rotated by angle degrees.
+func (l *LandmarkDetector) locate(d *Detection, row, col, scale int,
+	angle float64, img pigo.ImageParams) {
+
+	leftEye := l.puploc.RunDetector(pigo.Puploc{
+		Row:      row - int(0.075*float32(scale)),
+		Col:      col - int(0.175*float32(scale)),
+		Scale:    float32(scale) * 0.25,
+		Perturbs: perturbs,
+	}, img, pigoAngle(angle), false)
+	if found(leftEye) {
+		d.LeftEye = point(leftEye)
+	}
+
+	rightEye := l.puploc.RunDetector(pigo.Puploc{
+		Row:      row - int(0.075*float32(scale)),
+		Col:      col + int(0.185*float32(scale)),
+		Scale:    float32(scale) * 0.25,
+		Perturbs: perturbs,
+	}, img, pigoAngle(angle), false)
+	if found(rightEye) {
+		d.RightEye = point(rightEye)
+	}
+
+	// landmarks are located relatively to the eyes.
+	if l.flpcs == nil || d.LeftEye == nil || d.RightEye == nil {
+		return
+	}
+	add := func(name string, flipV bool) {
+		for _, flpc := range l.flpcs[name] {
+			p := flpc.GetLandmarkPoint(leftEye, rightEye, img, perturbs, flipV)
+			if found(p) {
+				d.Landmarks = append(d.Landmarks, *point(p))
+			}
+		}
+	}
+	for _, name := range eyeCascades {
+		add(name, false)
+		add(name, true)
+	}
+	for _, name := range mouthCascades {
+		add(name, false)
+	}
+	// lp84 locates a corner of the mouth.
+	add("lp84", true)
+}
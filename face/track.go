@@ -0,0 +1,191 @@
+package face
+
+import (
+	"image"
+	"sort"
+	"time"
+)
+
+// DefaultTrackTimeout is how long a face stays tracked without being
+// detected.
+const DefaultTrackTimeout = time.Second
+
+// Tracker associates the detections of consecutive frames. Each face
+// keeps the same track ID while it is visible, its box is smoothed
+// and its motion is used to predict where to look in the next frame.
+type Tracker struct {
+	// Timeout is how long a track survives without detection, this
+	// covers short occlusions and missed detections.
+	Timeout time.Duration
+	// MinIoU is the overlap between a predicted box and a detection
+	// required to associate them.
+	MinIoU float64
+	// Smoothing is the weight of a new detection in the box of a
+	// track, between 0 (frozen) and 1 (no smoothing).
+	Smoothing float64
+
+	tracks []*track
+	nextID int
+	last   time.Time
+}
+
+// track is a face followed across frames. Positions are in pixels
+// and velocities in pixels per second.
+type track struct {
+	id        int
+	x, y      float64 // center
+	w, h      float64 // size
+	vx, vy    float64
+	seen      time.Time
+	detection Detection
+}
+
+// NewTracker returns a tracker dropping faces unseen for timeout.
+func NewTracker(timeout time.Duration) *Tracker {
+	return &Tracker{
+		Timeout:   timeout,
+		MinIoU:    0.2,
+		Smoothing: 0.5,
+		nextID:    1,
+	}
+}
+
+// Reset forgets the tracked faces. The IDs are not reused.
+func (t *Tracker) Reset() {
+	t.tracks = nil
+	t.last = time.Time{}
+}
+
+func (k *track) box() image.Rectangle {
+	return image.Rect(
+		int(k.x-k.w/2+0.5), int(k.y-k.h/2+0.5),
+		int(k.x+k.w/2+0.5), int(k.y+k.h/2+0.5),
+	)
+}
+
+func iou(a, b image.Rectangle) float64 {
+	inter := a.Intersect(b)
+	if inter.Empty() {
+		return 0
+	}
+	i := inter.Dx() * inter.Dy()
+	union := a.Dx()*a.Dy() + b.Dx()*b.Dy() - i
+	return float64(i) / float64(union)
+}
+
+// Update associates the detections of the frame taken at timestamp
+// with the tracks. It returns the tracked faces: the detections with
+// their track ID and smoothed box, followed by the faces recently
+// lost, at their predicted position.
+func (t *Tracker) Update(detections []Detection, timestamp time.Time) []Detection {
+	if timestamp.Before(t.last) {
+		// the frames go back in time.
+		t.Reset()
+	}
+	dt := 0.0
+	if !t.last.IsZero() {
+		dt = timestamp.Sub(t.last).Seconds()
+	}
+	t.last = timestamp
+
+	// predict the position of the tracks.
+	for _, k := range t.tracks {
+		k.x += k.vx * dt
+		k.y += k.vy * dt
+	}
+
+	// greedy association by decreasing overlap.
+	type pair struct {
+		track, detection int
+		iou              float64
+	}
+	var pairs []pair
+	for i, k := range t.tracks {
+		box := k.box()
+		for j, d := range detections {
+			if v := iou(box, d.Box); v >= t.MinIoU {
+				pairs = append(pairs, pair{i, j, v})
+			}
+		}
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		return pairs[i].iou > pairs[j].iou
+	})
+	matched := make([]bool, len(t.tracks))
+	used := make([]bool, len(detections))
+	var tracked []Detection
+	for _, p := range pairs {
+		if matched[p.track] || used[p.detection] {
+			continue
+		}
+		matched[p.track], used[p.detection] = true, true
+		k, d := t.tracks[p.track], detections[p.detection]
+		t.correct(k, d, dt)
+		k.seen = timestamp
+		k.detection = d
+		d.Detected = d.Box
+		d.Box = k.box()
+		d.Track = k.id
+		tracked = append(tracked, d)
+	}
+
+	// unmatched detections start new tracks.
+	for j, d := range detections {
+		if used[j] {
+			continue
+		}
+		center := d.Center()
+		k := &track{
+			id:        t.nextID,
+			x:         float64(center.X),
+			y:         float64(center.Y),
+			w:         float64(d.Box.Dx()),
+			h:         float64(d.Box.Dy()),
+			seen:      timestamp,
+			detection: d,
+		}
+		t.nextID++
+		t.tracks = append(t.tracks, k)
+		matched = append(matched, true)
+		d.Detected = d.Box
+		d.Track = k.id
+		tracked = append(tracked, d)
+	}
+
+	// unmatched tracks coast until the timeout.
+	tracks := t.tracks[:0]
+	for i, k := range t.tracks {
+		if !matched[i] {
+			if timestamp.Sub(k.seen) > t.Timeout {
+				continue
+			}
+			d := k.detection
+			d.Box = k.box()
+			d.Track = k.id
+			d.Predicted = true
+			d.Detected = image.Rectangle{}
+			// the points are not moved with the box.
+			d.LeftEye, d.RightEye, d.Landmarks = nil, nil, nil
+			tracked = append(tracked, d)
+		}
+		tracks = append(tracks, k)
+	}
+	t.tracks = tracks
+	return tracked
+}
+
+// correct moves the predicted track toward the detection d and
+// updates its velocity.
+func (t *Tracker) correct(k *track, d Detection, dt float64) {
+	center := d.Center()
+	ex := float64(center.X) - k.x
+	ey := float64(center.Y) - k.y
+	k.x += t.Smoothing * ex
+	k.y += t.Smoothing * ey
+	k.w += t.Smoothing * (float64(d.Box.Dx()) - k.w)
+	k.h += t.Smoothing * (float64(d.Box.Dy()) - k.h)
+	if dt > 0 {
+		k.vx += t.Smoothing * ex / dt
+		k.vy += t.Smoothing * ey / dt
+	}
+}
@@ -0,0 +1,96 @@
+package face
+
+import (
+	"image"
+	"testing"
+	"time"
+)
+
+func box(x, y int) Detection {
+	return Detection{Box: image.Rect(x, y, x+40, y+40)}
+}
+
+func TestTrackerStableIDs(t *testing.T) {
+	tracker := NewTracker(time.Second)
+	start := time.Unix(1600000000, 0)
+	var ids [2]int
+	for i := 0; i < 10; i++ {
+		// two faces moving in opposite directions.
+		faces := tracker.Update([]Detection{
+			box(10+2*i, 100), box(300-2*i, 100),
+		}, start.Add(time.Duration(i)*100*time.Millisecond))
+		if len(faces) != 2 {
+			t.Fatalf("frame %d: got %d faces, want 2", i, len(faces))
+		}
+		// the order of the faces is not specified.
+		if faces[0].Box.Min.X > faces[1].Box.Min.X {
+			faces[0], faces[1] = faces[1], faces[0]
+		}
+		for j, f := range faces {
+			if f.Track == 0 || f.Predicted {
+				t.Fatalf("frame %d: face %d not tracked: %+v", i, j, f)
+			}
+			if want := box(10+2*i, 100).Box; j == 0 && f.Detected != want {
+				t.Errorf("frame %d: detected %s, want %s", i, f.Detected, want)
+			}
+			if i == 0 {
+				ids[j] = f.Track
+			} else if f.Track != ids[j] {
+				t.Errorf("frame %d: face %d changed track: %d, want %d",
+					i, j, f.Track, ids[j])
+			}
+		}
+	}
+	if ids[0] == ids[1] {
+		t.Errorf("faces share the track %d", ids[0])
+	}
+}
+
+func TestTrackerCoasting(t *testing.T) {
+	tracker := NewTracker(time.Second)
+	start := time.Unix(1600000000, 0)
+	faces := tracker.Update([]Detection{box(100, 100)}, start)
+	id := faces[0].Track
+
+	// the face is missed: it is predicted until the timeout.
+	for _, delay := range []time.Duration{
+		100 * time.Millisecond, 500 * time.Millisecond, time.Second,
+	} {
+		faces = tracker.Update(nil, start.Add(delay))
+		if len(faces) != 1 {
+			t.Fatalf("after %s: got %d faces, want 1", delay, len(faces))
+		}
+		if faces[0].Track != id || !faces[0].Predicted {
+			t.Errorf("after %s: got %+v, want predicted track %d",
+				delay, faces[0], id)
+		}
+	}
+	faces = tracker.Update(nil, start.Add(time.Second+time.Millisecond))
+	if len(faces) != 0 {
+		t.Errorf("after the timeout: got %d faces, want 0", len(faces))
+	}
+
+	// a face found again after the timeout gets a new track.
+	faces = tracker.Update([]Detection{box(100, 100)}, start.Add(2*time.Second))
+	if len(faces) != 1 || faces[0].Track == id {
+		t.Errorf("got %+v, want a new track", faces)
+	}
+}
+
+func TestTrackerBackward(t *testing.T) {
+	tracker := NewTracker(time.Second)
+	start := time.Unix(1600000000, 0)
+	faces := tracker.Update([]Detection{box(100, 100)}, start)
+	id := faces[0].Track
+
+	// going back in time, as when seeking a replay, forgets the
+	// tracks instead of predicting a move.
+	faces = tracker.Update(nil, start.Add(-time.Second))
+	if len(faces) != 0 {
+		t.Errorf("got %d faces after going back, want 0", len(faces))
+	}
+	faces = tracker.Update([]Detection{box(100, 100)}, start.Add(-time.Second))
+	if len(faces) != 1 || faces[0].Track == id || faces[0].Predicted {
+		t.Errorf("got %+v, want a new track", faces)
+	}
+}
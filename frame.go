@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image/color"
+	"time"
+
+	"github.com/lugu/qiloop/type/value"
+)
+
+// Frame is an ALImage returned by ALVideoDevice.
+type Frame struct {
+	Width      int
+	Height     int
+	Layers     int
+	ColorSpace int
+	Timestamp  time.Time
+	Camera     int
+	// Angles of the left, top, right and bottom edges of the image
+	// in radians.
+	Angles [4]float64
+	Pixels []byte
+}
+
+// parseFrame decodes the value returned by GetImageRemote. Only the
+// size and the pixels are required, the other fields are optional.
+func parseFrame(img value.Value) (*Frame, error) {
+	// GetImageRemote returns an value, let's cast it into a list
+	// of values:
+	values, ok := img.(value.ListValue)
+	if !ok || len(values) < 7 {
+		return nil, fmt.Errorf("Invalid type (not a list): %#v", img)
+	}
+	width, ok := intField(values, 0)
+	if !ok {
+		return nil, fmt.Errorf("Invalid width: %#v", values[0])
+	}
+	heigh, ok := intField(values, 1)
+	if !ok {
+		return nil, fmt.Errorf("Invalid height: %#v", values[1])
+	}
+	pixels, ok := values[6].(value.RawValue)
+	if !ok {
+		return nil, fmt.Errorf("Invalid pixels: %#v", values[6])
+	}
+	frame := &Frame{
+		Width:      width,
+		Height:     heigh,
+		Layers:     3,
+		ColorSpace: rgb,
+		Timestamp:  time.Now(),
+		Pixels:     pixels.Value(),
+	}
+	if layers, ok := intField(values, 2); ok {
+		frame.Layers = layers
+	}
+	if colorSpace, ok := intField(values, 3); ok {
+		frame.ColorSpace = colorSpace
+	}
+	sec, ok1 := intField(values, 4)
+	usec, ok2 := intField(values, 5)
+	if ok1 && ok2 {
+		frame.Timestamp = time.Unix(int64(sec), int64(usec)*1000)
+	}
+	if camera, ok := intField(values, 7); ok {
+		frame.Camera = camera
+	}
+	for i := range frame.Angles {
+		if angle, ok := floatField(values, 8+i); ok {
+			frame.Angles[i] = angle
+		}
+	}
+	return frame, nil
+}
+
+func intField(values value.ListValue, i int) (int, bool) {
+	if i >= len(values) {
+		return 0, false
+	}
+	v, ok := values[i].(value.IntValue)
+	if !ok {
+		return 0, false
+	}
+	return int(v.Value()), true
+}
+
+func floatField(values value.ListValue, i int) (float64, bool) {
+	if i >= len(values) {
+		return 0, false
+	}
+	v, ok := values[i].(value.FloatValue)
+	if !ok {
+		return 0, false
+	}
+	return float64(v.Value()), true
+}
+
+// Image decodes the frame into an RGB image which can be drawn on.
+func (f *Frame) Image() *imageRGB {
+	img := &imageRGB{
+		width:  f.Width,
+		heigh:  f.Height,
+		pixels: make([]byte, f.Width*f.Height*3),
+	}
+	pixels := f.Width * f.Height
+	switch f.ColorSpace {
+	case yuv:
+		for i := 0; i < pixels && 3*i+2 < len(f.Pixels); i++ {
+			r, g, b := color.YCbCrToRGB(f.Pixels[3*i],
+				f.Pixels[3*i+1], f.Pixels[3*i+2])
+			img.pixels[3*i], img.pixels[3*i+1], img.pixels[3*i+2] = r, g, b
+		}
+	case yuv422:
+		// Y0 U Y1 V: two pixels share the same chrominance.
+		for i := 0; i < pixels && 2*i+1 < len(f.Pixels); i++ {
+			pair := 4 * (i / 2)
+			if pair+3 >= len(f.Pixels) {
+				break
+			}
+			r, g, b := color.YCbCrToRGB(f.Pixels[2*i],
+				f.Pixels[pair+1], f.Pixels[pair+3])
+			img.pixels[3*i], img.pixels[3*i+1], img.pixels[3*i+2] = r, g, b
+		}
+	case bgr:
+		for i := 0; i < pixels && 3*i+2 < len(f.Pixels); i++ {
+			img.pixels[3*i] = f.Pixels[3*i+2]
+			img.pixels[3*i+1] = f.Pixels[3*i+1]
+			img.pixels[3*i+2] = f.Pixels[3*i]
+		}
+	case hsy:
+		// only the luma is shown: the hue and saturation are not
+		// converted.
+		for i := 0; i < pixels && 3*i+2 < len(f.Pixels); i++ {
+			y := f.Pixels[3*i+2]
+			img.pixels[3*i], img.pixels[3*i+1], img.pixels[3*i+2] = y, y, y
+		}
+	case depth, dist:
+		for i := 0; i < pixels && 2*i+1 < len(f.Pixels); i++ {
+			gray := distanceGray(f.Distance(i%f.Width, i/f.Width))
+			img.pixels[3*i], img.pixels[3*i+1], img.pixels[3*i+2] = gray, gray, gray
+		}
+	default:
+		copy(img.pixels, f.Pixels)
+	}
+	return img
+}
+
+// rgbFrame returns a copy of frame with the pixels of img.
+func rgbFrame(frame *Frame, img *imageRGB) *Frame {
+	f := *frame
+	f.ColorSpace = rgb
+	f.Layers = 3
+	f.Pixels = img.pixels
+	return &f
+}
+
+// Distance returns the distance in millimeters of a pixel of a depth
+// frame. Zero means unknown.
+func (f *Frame) Distance(x, y int) int {
+	i := 2 * (y*f.Width + x)
+	if x < 0 || x >= f.Width || y < 0 || i+1 >= len(f.Pixels) {
+		return 0
+	}
+	return int(binary.LittleEndian.Uint16(f.Pixels[i:]))
+}
+
+// distanceGray maps a distance to a gray level: closer is brighter
+// and unknown is black.
+func distanceGray(millimeters int) uint8 {
+	const maxDistance = 5000
+	if millimeters == 0 || millimeters >= maxDistance {
+		return 0
+	}
+	return uint8(255 - 255*millimeters/maxDistance)
+}
+
+// parseColorSpace returns the color space given its name.
+func parseColorSpace(name string) (int, error) {
+	for _, colorSpace := range []int{yuv422, yuv, rgb, bgr, depth, dist} {
+		if colorSpaceName(colorSpace) == name {
+			return colorSpace, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid color space: %s", name)
+}
+
+func colorSpaceName(colorSpace int) string {
+	switch colorSpace {
+	case yuv422:
+		return "yuv422"
+	case yuv:
+		return "yuv"
+	case rgb:
+		return "rgb"
+	case hsy:
+		return "hsy"
+	case bgr:
+		return "bgr"
+	case depth:
+		return "depth"
+	case dist:
+		return "distance"
+	}
+	return fmt.Sprintf("%d", colorSpace)
+}
+
+func resolutionName(resolution int) string {
+	switch resolution {
+	case qvga:
+		return "qvga"
+	case vga:
+		return "vga"
+	case vga4:
+		return "4vga"
+	}
+	return fmt.Sprintf("%d", resolution)
+}
+
+// cameraIDName returns the name of a camera as used by -camera.
+func cameraIDName(camera int) string {
+	switch camera {
+	case topCam:
+		return "top"
+	case bottomCam:
+		return "bottom"
+	case depthCam:
+		return "depth"
+	case stereoCam:
+		return "stereo"
+	}
+	return fmt.Sprintf("%d", camera)
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/lugu/qiview/face"
+)
+
+var (
+	// galleryDir receives the best crop of each tracked face.
+	galleryDir = ""
+	// galleryPadding enlarges the crops around the faces,
+	// relatively to the size of the faces.
+	galleryPadding = 0.3
+)
+
+// galleryEntry describes a crop in the index of the gallery.
+type galleryEntry struct {
+	Track     int             `json:"track"`
+	Crop      string          `json:"crop"`
+	Frame     string          `json:"frame"`
+	Score     float32         `json:"score"`
+	Timestamp time.Time       `json:"timestamp"`
+	Camera    string          `json:"camera"`
+	CameraID  int             `json:"camera_id"`
+	Source    string          `json:"source"`
+	Box       image.Rectangle `json:"box"`
+	Width     int             `json:"width"`
+	Height    int             `json:"height"`
+}
+
+var (
+	galleryMutex sync.Mutex
+	// galleryEntries holds the best crop of each track.
+	galleryEntries = map[int]*galleryEntry{}
+	// gallerySession prefixes the crops since the track IDs restart
+	// with each session.
+	gallerySession = time.Now().Format("20060102-150405")
+)
+
+// gallerySource describes where the frames come from, without the
+// credentials of the robot address.
+func gallerySource() string {
+	if replayFile != "" {
+		return replayFile
+	}
+	return publicURL(robotURL())
+}
+
+// updateGallery saves the crop of the tracked faces of frame which
+// score better than the crop saved for their track, with the whole
+// frame.
+func updateGallery(frame *Frame, faces []face.Detection) {
+	if galleryDir == "" {
+		return
+	}
+	galleryMutex.Lock()
+	defer galleryMutex.Unlock()
+	var img *imageRGB
+	updated := false
+	for _, f := range faces {
+		if f.Track == 0 || f.Predicted {
+			continue
+		}
+		if best, ok := galleryEntries[f.Track]; ok && best.Score >= f.Score {
+			continue
+		}
+		if img == nil {
+			img = frame.Image()
+		}
+		crop := padded(f.Box, galleryPadding).Intersect(img.Bounds())
+		if crop.Empty() {
+			continue
+		}
+		entry := &galleryEntry{
+			Track:     f.Track,
+			Crop:      fmt.Sprintf("face-%s-%d.png", gallerySession, f.Track),
+			Frame:     fmt.Sprintf("frame-%s-%d.png", gallerySession, f.Track),
+			Score:     f.Score,
+			Timestamp: frame.Timestamp,
+			Camera:    cameraIDName(frame.Camera),
+			CameraID:  frame.Camera,
+			Source:    gallerySource(),
+			Box:       f.Box,
+			Width:     frame.Width,
+			Height:    frame.Height,
+		}
+		if err := writePNG(filepath.Join(galleryDir, entry.Crop), cropImage(img, crop)); err != nil {
+			notify("gallery: %s", err)
+			return
+		}
+		if err := writePNG(filepath.Join(galleryDir, entry.Frame), img); err != nil {
+			notify("gallery: %s", err)
+			return
+		}
+		galleryEntries[f.Track] = entry
+		updated = true
+	}
+	if updated {
+		if err := writeGalleryIndex(); err != nil {
+			notify("gallery: %s", err)
+		}
+	}
+}
+
+// cropImage returns a copy of the area r of img.
+func cropImage(img *imageRGB, r image.Rectangle) *imageRGB {
+	dst := newImageRGB(r.Dx(), r.Dy())
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		i := 3 * (y*img.width + r.Min.X)
+		copy(dst.pixels[3*(y-r.Min.Y)*dst.width:], img.pixels[i:i+3*r.Dx()])
+	}
+	return dst
+}
+
+// writeGalleryIndex writes the entries of the session, ordered by
+// track, to a JSON file next to the crops.
+func writeGalleryIndex() error {
+	entries := make([]*galleryEntry, 0, len(galleryEntries))
+	for _, entry := range galleryEntries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Track < entries[j].Track
+	})
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	file := filepath.Join(galleryDir, "faces-"+gallerySession+".json")
+	return ioutil.WriteFile(file, data, 0644)
+}
+
+// openGallery creates the gallery directory.
+func openGallery() error {
+	if err := os.MkdirAll(galleryDir, 0755); err != nil {
+		return fmt.Errorf("gallery directory: %s", err)
+	}
+	return nil
+}
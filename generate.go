@@ -1,3 +1,4 @@
 //go:generate qiloop proxy --idl video_device.qi.idl --output video_proxy.go
+//go:generate qiloop proxy --idl memory.qi.idl --output memory_proxy.go
 
 package main
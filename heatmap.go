@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"image/color"
+	"math"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lugu/qiview/face"
+)
+
+const (
+	heatmapColumns = 32
+	heatmapRows    = 24
+	// heatmapAlpha is the opacity of the hottest cell.
+	heatmapAlpha = 0.6
+)
+
+var (
+	showHeatmap = false
+	// occupancyFile receives the number of faces of each minute.
+	occupancyFile = ""
+)
+
+var (
+	// statsMutex protects the heatmap and the occupancy which are
+	// updated by the detection.
+	statsMutex sync.Mutex
+	statsLast  time.Time
+	// heatmap counts the face centers per cell of the frame.
+	heatmap [heatmapRows][heatmapColumns]int
+
+	occupancyOut    *os.File
+	occupancyWriter *csv.Writer
+	minute          occupancyMinute
+)
+
+// occupancyMinute accumulates the faces seen during a minute.
+type occupancyMinute struct {
+	start  time.Time
+	frames int
+	faces  int
+	max    int
+	tracks map[int]bool
+}
+
+// openOccupancy creates the occupancy CSV file.
+func openOccupancy(file string) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return fmt.Errorf("occupancy output: %s", err)
+	}
+	statsMutex.Lock()
+	defer statsMutex.Unlock()
+	occupancyOut, occupancyWriter = f, csv.NewWriter(f)
+	// frames counts the frames analyzed by the detector: about
+	// faceFPS per second, or every frame in privacy mode and in the
+	// non-interactive outputs.
+	occupancyWriter.Write([]string{"minute", "frames", "mean_faces",
+		"max_faces", "tracks"})
+	return nil
+}
+
+// updateStats accumulates the faces detected in frame. Only the
+// frames more recent than the last one are counted: a frame processed
+// again while paused, after a rewind or when a replay loops is
+// ignored.
+func updateStats(frame *Frame, faces []face.Detection) {
+	statsMutex.Lock()
+	defer statsMutex.Unlock()
+	if !frame.Timestamp.After(statsLast) || frame.Width == 0 || frame.Height == 0 {
+		return
+	}
+	statsLast = frame.Timestamp
+
+	visible := 0
+	for _, f := range faces {
+		if f.Predicted {
+			continue
+		}
+		visible++
+		center := f.Center()
+		column := clampInt(center.X*heatmapColumns/frame.Width, 0, heatmapColumns-1)
+		row := clampInt(center.Y*heatmapRows/frame.Height, 0, heatmapRows-1)
+		heatmap[row][column]++
+	}
+
+	if occupancyWriter == nil {
+		return
+	}
+	start := frame.Timestamp.Truncate(time.Minute)
+	if !start.Equal(minute.start) {
+		writeMinute()
+		minute = occupancyMinute{start: start, tracks: map[int]bool{}}
+	}
+	minute.frames++
+	minute.faces += visible
+	if visible > minute.max {
+		minute.max = visible
+	}
+	for _, f := range faces {
+		if f.Track != 0 && !f.Predicted {
+			minute.tracks[f.Track] = true
+		}
+	}
+}
+
+// writeMinute writes the row of the current minute.
+func writeMinute() {
+	if minute.frames == 0 {
+		return
+	}
+	occupancyWriter.Write([]string{
+		minute.start.Format(time.RFC3339),
+		strconv.Itoa(minute.frames),
+		strconv.FormatFloat(float64(minute.faces)/float64(minute.frames), 'f', 2, 64),
+		strconv.Itoa(minute.max),
+		strconv.Itoa(len(minute.tracks)),
+	})
+	occupancyWriter.Flush()
+	if err := occupancyWriter.Error(); err != nil {
+		notify("occupancy output: %s", err)
+	}
+}
+
+// closeOccupancy writes the last minute and closes the file.
+func closeOccupancy() error {
+	statsMutex.Lock()
+	defer statsMutex.Unlock()
+	if occupancyOut == nil {
+		return nil
+	}
+	writeMinute()
+	err := occupancyOut.Close()
+	occupancyOut, occupancyWriter = nil, nil
+	return err
+}
+
+// heatColor maps a level between 0 and 1 from blue to red.
+func heatColor(level float64) (float64, float64, float64) {
+	switch {
+	case level < 0.5:
+		return 0, 2 * level, 1 - 2*level
+	default:
+		return 2*level - 1, 2 - 2*level, 0
+	}
+}
+
+// heatmap blends the heatmap over the area of the canvas. In the
+// terminal only the colors of the characters are blended.
+func (c canvas) heatmap() {
+	set := c.img.Set
+	if view, ok := c.img.(*View); ok {
+		set = view.SetColor
+	}
+	statsMutex.Lock()
+	cells := heatmap
+	statsMutex.Unlock()
+	max := 0
+	for _, row := range cells {
+		for _, count := range row {
+			if count > max {
+				max = count
+			}
+		}
+	}
+	if max == 0 {
+		return
+	}
+	size := c.area.Size()
+	for y := c.area.Min.Y; y < c.area.Max.Y; y++ {
+		row := (y - c.area.Min.Y) * heatmapRows / size.Y
+		for x := c.area.Min.X; x < c.area.Max.X; x++ {
+			count := cells[row][(x-c.area.Min.X)*heatmapColumns/size.X]
+			if count == 0 {
+				continue
+			}
+			level := math.Sqrt(float64(count) / float64(max))
+			alpha := heatmapAlpha * level
+			hr, hg, hb := heatColor(level)
+			r, g, b, _ := c.img.At(x, y).RGBA()
+			blend := func(v uint32, h float64) uint8 {
+				return uint8((1-alpha)*float64(v>>8) + alpha*255*h)
+			}
+			set(x, y, color.RGBA{blend(r, hr), blend(g, hg),
+				blend(b, hb), 0xff})
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"image/color"
+	"io"
+	"os"
+	"time"
+
+	tb "github.com/nsf/termbox-go"
+)
+
+var htmlFile = ""
+
+const htmlHeader = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>qiview</title>
+<style>
+body { background: #000; margin: 0; }
+pre { font-family: monospace; font-size: 10px; line-height: 1; margin: 0; }
+</style>
+</head>
+<body>
+`
+
+const htmlFooter = `</body>
+</html>
+`
+
+// htmlPlayer shows the frames one after the other using the delays
+// (in milliseconds) stored in the data-delay attributes.
+const htmlPlayer = `<script>
+(function() {
+	var frames = document.getElementsByTagName("pre");
+	var current = 0;
+	function next() {
+		frames[current].style.display = "none";
+		current = (current + 1) % frames.length;
+		frames[current].style.display = "block";
+		setTimeout(next, frames[current].dataset.delay);
+	}
+	setTimeout(next, frames[0].dataset.delay);
+})();
+</script>
+`
+
+// paletteColor returns the RGB value of a color of the xterm 256
+// colors palette.
+func paletteColor(index int) color.RGBA {
+	standard := []color.RGBA{
+		{0x00, 0x00, 0x00, 0xff}, {0x80, 0x00, 0x00, 0xff},
+		{0x00, 0x80, 0x00, 0xff}, {0x80, 0x80, 0x00, 0xff},
+		{0x00, 0x00, 0x80, 0xff}, {0x80, 0x00, 0x80, 0xff},
+		{0x00, 0x80, 0x80, 0xff}, {0xc0, 0xc0, 0xc0, 0xff},
+		{0x80, 0x80, 0x80, 0xff}, {0xff, 0x00, 0x00, 0xff},
+		{0x00, 0xff, 0x00, 0xff}, {0xff, 0xff, 0x00, 0xff},
+		{0x00, 0x00, 0xff, 0xff}, {0xff, 0x00, 0xff, 0xff},
+		{0x00, 0xff, 0xff, 0xff}, {0xff, 0xff, 0xff, 0xff},
+	}
+	switch {
+	case index < 0:
+		return standard[7]
+	case index < 16:
+		return standard[index]
+	case index < 232:
+		levels := []uint8{0x00, 0x5f, 0x87, 0xaf, 0xd7, 0xff}
+		index -= 16
+		return color.RGBA{
+			levels[index/36], levels[(index/6)%6], levels[index%6], 0xff,
+		}
+	case index < 256:
+		gray := uint8(8 + 10*(index-232))
+		return color.RGBA{gray, gray, gray, 0xff}
+	}
+	return standard[15]
+}
+
+// writeHTMLFrame writes the view as a <pre> block with one span per
+// run of cells sharing the same color.
+func (self *View) writeHTMLFrame(out *bufio.Writer, attrs string) {
+	fmt.Fprintf(out, "<pre%s>", attrs)
+	for by := 0; by < self.heigh; by++ {
+		fg := tb.Attribute(0)
+		for bx := 0; bx < self.width; bx++ {
+			c := self.cells[by][bx]
+			if c.Fg != fg {
+				if fg != 0 {
+					out.WriteString("</span>")
+				}
+				// termbox 256 colors attributes are shifted by one.
+				col := paletteColor(int(c.Fg) - 1)
+				fmt.Fprintf(out, `<span style="color:#%02x%02x%02x">`,
+					col.R, col.G, col.B)
+				fg = c.Fg
+			}
+			out.WriteString(html.EscapeString(string(c.Ch)))
+		}
+		if fg != 0 {
+			out.WriteString("</span>")
+		}
+		out.WriteByte('\n')
+	}
+	out.WriteString("</pre>\n")
+}
+
+// htmlRecorder writes the views to an HTML page which plays them. A
+// view is written when the next one is recorded, once its delay is
+// known, so that only one view is kept in memory.
+type htmlRecorder struct {
+	file    *os.File // nil when writing to a writer
+	out     *bufio.Writer
+	pending *View
+	time    time.Time
+	frames  int
+}
+
+// newHTMLRecorder starts an HTML page on w.
+func newHTMLRecorder(w io.Writer) *htmlRecorder {
+	h := &htmlRecorder{
+		out: bufio.NewWriter(w),
+	}
+	h.out.WriteString(htmlHeader)
+	return h
+}
+
+// newHTMLRecorderFile creates the HTML page filename.
+func newHTMLRecorderFile(filename string) (*htmlRecorder, error) {
+	file, err := os.Create(filename)
+	if err != nil {
+		return nil, fmt.Errorf("create html: %s", err)
+	}
+	h := newHTMLRecorder(file)
+	h.file = file
+	return h, nil
+}
+
+// Record adds a copy of view to the sequence: the view can be
+// modified afterward, for example with the status line.
+func (h *htmlRecorder) Record(view *View) {
+	now := time.Now()
+	h.flush(now.Sub(h.time))
+	h.pending, h.time = view.Clone(), now
+}
+
+// flush writes the pending view displayed for delay.
+func (h *htmlRecorder) flush(delay time.Duration) {
+	if h.pending == nil {
+		return
+	}
+	attrs := fmt.Sprintf(` data-delay="%d"`, delay/time.Millisecond)
+	if h.frames != 0 {
+		attrs += ` style="display:none"`
+	}
+	h.pending.writeHTMLFrame(h.out, attrs)
+	h.pending = nil
+	h.frames++
+}
+
+// Close writes the last view and the end of the page. The page plays
+// the views if there is more than one.
+func (h *htmlRecorder) Close() error {
+	h.flush(time.Second / time.Duration(fps))
+	var err error
+	if h.frames == 0 {
+		err = fmt.Errorf("no frame to export")
+	}
+	if h.frames > 1 {
+		h.out.WriteString(htmlPlayer)
+	}
+	h.out.WriteString(htmlFooter)
+	if flushErr := h.out.Flush(); err == nil && flushErr != nil {
+		err = fmt.Errorf("write html: %s", flushErr)
+	}
+	if h.file != nil {
+		if closeErr := h.file.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
@@ -1,8 +1,11 @@
 package main
 
 import (
+	"bufio"
+	"fmt"
 	"image"
 	"image/color"
+	"io"
 	"math"
 
 	"github.com/nfnt/resize"
@@ -49,9 +52,20 @@ func (i *imageRGB) Set(x, y int, col color.Color) {
 		return
 	}
 	r, g, b, _ := col.RGBA()
-	i.pixels[3*y*i.width+3*x] = byte(r)
-	i.pixels[3*y*i.width+3*x+1] = byte(g)
-	i.pixels[3*y*i.width+3*x+2] = byte(b)
+	i.pixels[3*y*i.width+3*x] = byte(r >> 8)
+	i.pixels[3*y*i.width+3*x+1] = byte(g >> 8)
+	i.pixels[3*y*i.width+3*x+2] = byte(b >> 8)
+}
+
+// Clone returns a copy of the image.
+func (i *imageRGB) Clone() *imageRGB {
+	pixels := make([]byte, len(i.pixels))
+	copy(pixels, i.pixels)
+	return &imageRGB{
+		pixels: pixels,
+		width:  i.width,
+		heigh:  i.heigh,
+	}
 }
 
 type View struct {
@@ -144,9 +158,14 @@ func toAscii(col color.Color) rune {
 	return pixels[index]
 }
 
+// NewView renders img at the size of the terminal.
 func NewView(img image.Image) *View {
-
 	width, heigh := tb.Size()
+	return newView(img, width, heigh)
+}
+
+func newView(img image.Image, width, heigh int) *View {
+
 	newImage := resize.Resize(uint(width), uint(heigh), img,
 		resize.NearestNeighbor)
 
@@ -176,6 +195,19 @@ func NewView(img image.Image) *View {
 	return view
 }
 
+// Clone returns a copy of the view.
+func (self *View) Clone() *View {
+	view := &View{
+		width: self.width,
+		heigh: self.heigh,
+		cells: make([][]tb.Cell, len(self.cells)),
+	}
+	for line := range self.cells {
+		view.cells[line] = append([]tb.Cell(nil), self.cells[line]...)
+	}
+	return view
+}
+
 func (self *View) Print() {
 
 	for bx := 0; bx < self.width; bx++ {
@@ -186,3 +218,100 @@ func (self *View) Print() {
 	}
 	tb.Flush()
 }
+
+// View implements draw.Image in order to draw overlays on the
+// terminal.
+func (self *View) ColorModel() color.Model {
+	return color.RGBAModel
+}
+
+func (self *View) Bounds() image.Rectangle {
+	return image.Rect(0, 0, self.width, self.heigh)
+}
+
+func (self *View) At(x, y int) color.Color {
+	if x < 0 || x >= self.width || y < 0 || y >= self.heigh {
+		return color.RGBA{}
+	}
+	// termbox 256 colors attributes are shifted by one.
+	return paletteColor(int(self.cells[y][x].Fg) - 1)
+}
+
+// Set replaces the cell with a '+' of the given color.
+func (self *View) Set(x, y int, col color.Color) {
+	if x < 0 || x >= self.width || y < 0 || y >= self.heigh {
+		return
+	}
+	self.cells[y][x] = tb.Cell{
+		Ch: '+',
+		Fg: tb.Attribute(colorise(col)),
+		Bg: tb.Attribute(0),
+	}
+}
+
+// SetColor changes the color of the cell, keeping its character.
+func (self *View) SetColor(x, y int, col color.Color) {
+	if x < 0 || x >= self.width || y < 0 || y >= self.heigh {
+		return
+	}
+	self.cells[y][x].Fg = tb.Attribute(colorise(col))
+}
+
+// SetText writes text on the line y of the view starting at column x.
+func (self *View) SetText(x, y int, text string) {
+	if y < 0 || y >= self.heigh {
+		return
+	}
+	for _, ch := range text {
+		if x >= self.width {
+			return
+		}
+		if x >= 0 {
+			self.cells[y][x] = tb.Cell{
+				Ch: ch,
+				Fg: tb.ColorWhite,
+				Bg: tb.ColorBlack,
+			}
+		}
+		x++
+	}
+}
+
+// WriteANSI writes the view as text colored with 256 colors escape
+// sequences.
+func (self *View) WriteANSI(w io.Writer) error {
+	out := bufio.NewWriter(w)
+	for by := 0; by < self.heigh; by++ {
+		self.writeANSILine(out, by)
+		out.WriteByte('\n')
+	}
+	return out.Flush()
+}
+
+// writeANSILine writes the line by of the view followed by a color
+// reset.
+func (self *View) writeANSILine(out *bufio.Writer, by int) {
+	fg := tb.Attribute(0)
+	for bx := 0; bx < self.width; bx++ {
+		c := self.cells[by][bx]
+		if c.Fg != fg {
+			// termbox 256 colors attributes are shifted by one.
+			fmt.Fprintf(out, "\x1b[38;5;%dm", c.Fg-1)
+			fg = c.Fg
+		}
+		out.WriteRune(c.Ch)
+	}
+	out.WriteString("\x1b[0m")
+}
+
+// WriteText writes the view as plain ASCII text.
+func (self *View) WriteText(w io.Writer) error {
+	out := bufio.NewWriter(w)
+	for by := 0; by < self.heigh; by++ {
+		for bx := 0; bx < self.width; bx++ {
+			out.WriteRune(self.cells[by][bx].Ch)
+		}
+		out.WriteByte('\n')
+	}
+	return out.Flush()
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"strings"
+
+	"github.com/hajimehoshi/ebiten"
+	"github.com/hajimehoshi/ebiten/ebitenutil"
+	"github.com/hajimehoshi/ebiten/inpututil"
+)
+
+const (
+	maxZoom         = 32.0
+	timelineHeigh   = 12 // area where the mouse scrubs the timeline
+	debugCharWidth  = 6
+	debugCharHeigh  = 16
+	inspectorMargin = 12
+)
+
+var (
+	// the image is drawn scaled by zoom at (panX, panY).
+	zoom       = 1.0
+	panX, panY = 0.0, 0.0
+	dragging   = false
+	dragX      = 0
+	dragY      = 0
+	inspector  = false
+)
+
+// clampPan keeps the image covering the screen.
+func clampPan(width, heigh int) {
+	panX = math.Min(0, math.Max(panX, float64(width)*(1-zoom)))
+	panY = math.Min(0, math.Max(panY, float64(heigh)*(1-zoom)))
+}
+
+// handleMouse zooms with the mouse wheel around the cursor and pans
+// when the image is dragged.
+func handleMouse(width, heigh int) {
+	x, y := ebiten.CursorPosition()
+
+	if _, wheel := ebiten.Wheel(); wheel != 0 {
+		scale := math.Pow(1.1, wheel)
+		newZoom := math.Min(maxZoom, math.Max(1, zoom*scale))
+		// keep the pixel under the cursor in place.
+		panX = float64(x) - (float64(x)-panX)*newZoom/zoom
+		panY = float64(y) - (float64(y)-panY)*newZoom/zoom
+		zoom = newZoom
+	}
+
+	if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) &&
+		!(paused && y >= heigh-timelineHeigh) && !drawingMask {
+		dragging = true
+		dragX, dragY = x, y
+	}
+	if !ebiten.IsMouseButtonPressed(ebiten.MouseButtonLeft) {
+		dragging = false
+	}
+	if dragging {
+		panX += float64(x - dragX)
+		panY += float64(y - dragY)
+		dragX, dragY = x, y
+	}
+	clampPan(width, heigh)
+}
+
+// resetZoom displays the whole image.
+func resetZoom() {
+	zoom, panX, panY = 1, 0, 0
+}
+
+// imageOptions returns the transformation applied to the image.
+func imageOptions() *ebiten.DrawImageOptions {
+	op := &ebiten.DrawImageOptions{}
+	op.GeoM.Scale(zoom, zoom)
+	op.GeoM.Translate(panX, panY)
+	if zoom > 1 {
+		op.Filter = ebiten.FilterNearest
+	}
+	return op
+}
+
+// screenToImage returns the pixel of the image under a screen point.
+func screenToImage(x, y int) (int, int) {
+	return int(math.Floor((float64(x) - panX) / zoom)),
+		int(math.Floor((float64(y) - panY) / zoom))
+}
+
+// rgbToHSV returns the hue in degrees, the saturation and the value
+// in percent.
+func rgbToHSV(r, g, b uint8) (int, int, int) {
+	R, G, B := float64(r)/255, float64(g)/255, float64(b)/255
+	max := math.Max(R, math.Max(G, B))
+	min := math.Min(R, math.Min(G, B))
+	delta := max - min
+	var h float64
+	switch {
+	case delta == 0:
+		h = 0
+	case max == R:
+		h = 60 * math.Mod((G-B)/delta, 6)
+	case max == G:
+		h = 60 * ((B-R)/delta + 2)
+	default:
+		h = 60 * ((R-G)/delta + 4)
+	}
+	if h < 0 {
+		h += 360
+	}
+	s := 0.0
+	if max != 0 {
+		s = delta / max
+	}
+	return int(h + 0.5), int(100*s + 0.5), int(100*max + 0.5)
+}
+
+// pixelInfo describes the pixel (x, y) of the last frame.
+func pixelInfo(x, y int) []string {
+	c := lastRaw.At(x, y).(color.RGBA)
+	h, s, v := rgbToHSV(c.R, c.G, c.B)
+	Y, U, V := color.RGBToYCbCr(c.R, c.G, c.B)
+	info := []string{
+		fmt.Sprintf("x=%d y=%d", x, y),
+		fmt.Sprintf("RGB %d %d %d", c.R, c.G, c.B),
+		fmt.Sprintf("HSV %d %d%% %d%%", h, s, v),
+		fmt.Sprintf("YUV %d %d %d", Y, U, V),
+	}
+	if lastFrame.ColorSpace == depth || lastFrame.ColorSpace == dist {
+		if d := lastFrame.Distance(x, y); d != 0 {
+			info = append(info, fmt.Sprintf("%d mm", d))
+		} else {
+			info = append(info, "no distance")
+		}
+	}
+	return info
+}
+
+// drawInspector displays the values of the pixel under the cursor.
+func drawInspector(screen *ebiten.Image, width, heigh int) {
+	if lastRaw == nil {
+		return
+	}
+	cx, cy := ebiten.CursorPosition()
+	x, y := screenToImage(cx, cy)
+	if x < 0 || y < 0 || x >= lastRaw.width || y >= lastRaw.heigh {
+		return
+	}
+	lines := pixelInfo(x, y)
+	w, h := 0, len(lines)*debugCharHeigh
+	for _, line := range lines {
+		if len(line)*debugCharWidth > w {
+			w = len(line) * debugCharWidth
+		}
+	}
+	// place the tooltip next to the cursor, inside the screen.
+	tx, ty := cx+inspectorMargin, cy+inspectorMargin
+	if tx+w > width {
+		tx = cx - inspectorMargin - w
+	}
+	if ty+h > heigh {
+		ty = cy - inspectorMargin - h
+	}
+	ebitenutil.DrawRect(screen, float64(tx-2), float64(ty), float64(w+4),
+		float64(h), color.RGBA{0, 0, 0, 0xc0})
+	ebitenutil.DebugPrintAt(screen, strings.Join(lines, "\n"), tx, ty)
+}
@@ -9,12 +9,14 @@ import (
 	"image/color"
 	_ "image/jpeg"
 	"log"
+	"os"
+	"os/signal"
 	"time"
 
 	"github.com/hajimehoshi/ebiten"
+	"github.com/hajimehoshi/ebiten/ebitenutil"
 	"github.com/hajimehoshi/ebiten/inpututil"
 	"github.com/lugu/qiloop/app"
-	"github.com/lugu/qiloop/type/value"
 	"github.com/lugu/qiview/face"
 	tb "github.com/nsf/termbox-go"
 )
@@ -29,47 +31,92 @@ const (
 	vga  = 2
 	vga4 = 3
 
-	yuv  = 10
-	rgb  = 11
-	hsv  = 12
-	dist = 21
+	yuv422 = 9
+	yuv    = 10
+	rgb    = 11
+	hsy    = 12
+	bgr    = 13
+	depth  = 17
+	dist   = 21
 
 	screenWidth  = 640
 	screenHeight = 480
 )
 
 var (
-	id          = "ascii" // video device subscriber id
-	fps         = 15
-	cameraName  = "top"
-	videoDevice ALVideoDeviceProxy
-	detectFaces = false
+	id           = "ascii" // video device subscriber id
+	fps          = 15
+	cameraName   = "top"
+	resolution   = qvga
+	colorSpace   = rgb
+	source       frameSource
+	replayFile   = ""
+	history      *frameRing
+	detectFaces  = false
+	detector     *face.Detector
+	tracker      *face.Tracker
+	trackFaces   = true
+	trackTimeout = face.DefaultTrackTimeout
+
+	// last frame displayed
+	lastFrame *Frame
+	lastRaw   *imageRGB
+	lastImage image.Image
+	lastFaces []face.Detection
+	// lastFacesTime is the timestamp of the frame of lastFaces.
+	lastFacesTime time.Time
 
 	errQuit    = errors.New("Quitting...")
 	firstFrame = true
 )
 
-func getImage() (image.Image, error) {
-
-	img, err := videoDevice.GetImageRemote(id)
+// nextFrame returns the next frame of the source after hiding the
+// faces if needed and recording it. With syncDetection, the faces of
+// the frame are detected before it is returned.
+func nextFrame() (*Frame, error) {
+	frame, err := source.Next()
 	if err != nil {
-		return nil, fmt.Errorf("GetImageRemote: %s", err)
+		return nil, err
+	}
+	if privacyMode != "" {
+		frame = anonymize(frame)
+	}
+	frame = applyMasks(frame)
+	if detector != nil && privacyMode == "" && syncDetection {
+		detect(frame, time.Now())
 	}
+	recordFrame(frame)
+	history.Push(frame)
+	return frame, nil
+}
+
+func getImage() (*imageRGB, error) {
 
-	// GetImageRemote returns an value, let's cast it into a list
-	// of values:
-	values, ok := img.(value.ListValue)
-	if !ok {
-		return nil, fmt.Errorf("Invalid type (not a list): %#v", img)
+	frame, err := nextFrame()
+	if err != nil {
+		return nil, err
 	}
-	image := &imageRGB{
-		width:  int(values[0].(value.IntValue).Value()),
-		heigh:  int(values[1].(value.IntValue).Value()),
-		pixels: values[6].(value.RawValue).Value(),
+	frame = displayedFrame(frame)
+	var faces []face.Detection
+	var facesTime time.Time
+	raw := frame.Image()
+	image := raw.Clone()
+	if detector != nil {
+		if privacyMode == "" && !syncDetection {
+			submitDetection(frame)
+		}
+		faces, facesTime = lastDetections()
+		face.Draw(image, faces)
 	}
-	if detectFaces {
-		face.Draw(image)
+	if compareSource != nil {
+		second, err := nextCompareImage()
+		if err != nil {
+			return nil, err
+		}
+		image = compose(image, second)
 	}
+	lastFrame, lastRaw, lastImage = frame, raw, image
+	lastFaces, lastFacesTime = faces, facesTime
 	return image, nil
 }
 
@@ -78,9 +125,37 @@ func ascii() error {
 		return err
 	}
 
-	tb.SetInputMode(tb.InputEsc)
+	tb.SetInputMode(tb.InputEsc | tb.InputMouse)
 	tb.SetOutputMode(tb.Output256)
 
+	var cast *castRecorder
+	if castFile != "" {
+		width, heigh := tb.Size()
+		var err error
+		cast, err = newCastRecorder(castFile, width, heigh)
+		if err != nil {
+			tb.Close()
+			return err
+		}
+		defer cast.Close()
+	}
+	var record *htmlRecorder
+	if htmlFile != "" {
+		var err error
+		record, err = newHTMLRecorderFile(htmlFile)
+		if err != nil {
+			tb.Close()
+			return err
+		}
+	}
+	exit := func() error {
+		tb.Close()
+		if record != nil {
+			return record.Close()
+		}
+		return nil
+	}
+
 	go func() {
 		for {
 			tb.Interrupt()
@@ -99,17 +174,111 @@ func ascii() error {
 			}
 
 			view := NewView(image)
+			drawOverlays(view, lastFrame)
+			if cast != nil {
+				if err := cast.Record(view); err != nil {
+					tb.Close()
+					return err
+				}
+			}
+			if record != nil {
+				record.Record(view)
+			}
+			line := view.heigh - 1
+			if paused {
+				view.SetText(0, line, timelineText(view.width))
+				line--
+			}
+			if text := status(); text != "" {
+				view.SetText(0, line, text)
+			}
 			view.Print()
 		case tb.EventKey:
 			if e.Key == tb.KeyCtrlC || e.Ch == 'q' || e.Key == tb.KeyEsc {
-				tb.Close()
-				return nil
+				return exit()
+			}
+			if e.Ch == 's' {
+				saveSnapshot()
+			}
+			if e.Ch == 'r' {
+				toggleRecording()
+			}
+			if e.Ch == 'g' {
+				exportClip()
+			}
+			toggleOverlay(e.Ch)
+			if e.Ch == 'm' {
+				nextCompareMode()
+			}
+			switch e.Key {
+			case tb.KeySpace:
+				togglePause()
+			case tb.KeyArrowLeft:
+				step(-1)
+			case tb.KeyArrowRight:
+				step(1)
+			case tb.KeyHome:
+				seek(0)
+			case tb.KeyEnd:
+				seek(1)
+			}
+		case tb.EventMouse:
+			// click on the timeline to seek.
+			width, heigh := tb.Size()
+			if e.Key == tb.MouseLeft && paused && e.MouseY == heigh-1 && width > 1 {
+				seek(float64(e.MouseX) / float64(width-1))
 			}
 		}
 
 	}
 }
 
+// saveSnapshot saves the last frame and reports the result in the
+// viewer.
+func saveSnapshot() {
+	filename, err := snapshot()
+	if err != nil {
+		notify("%s", err)
+		return
+	}
+	notify("saved %s", filename)
+}
+
+// drawTimeline draws the position in the history at the bottom of
+// the screen.
+func drawTimeline(screen *ebiten.Image, width, heigh int) {
+	const barHeigh = 6
+	count := history.Len()
+	if count == 0 {
+		return
+	}
+	y := float64(heigh - barHeigh)
+	ebitenutil.DrawRect(screen, 0, y, float64(width), barHeigh,
+		color.RGBA{0x40, 0x40, 0x40, 0xc0})
+	cursor := 0.0
+	if count > 1 {
+		cursor = float64(positionIndex()*(width-1)) / float64(count-1)
+	}
+	ebitenutil.DrawRect(screen, 0, y, cursor, barHeigh,
+		color.RGBA{0xa0, 0xa0, 0xa0, 0xc0})
+	ebitenutil.DrawRect(screen, cursor-1, y, 3, barHeigh,
+		color.RGBA{0xff, 0xff, 0xff, 0xff})
+	ebitenutil.DebugPrintAt(screen, timelineText(0), 0, heigh-barHeigh-16)
+}
+
+// scrub seeks in the history when the timeline is clicked or
+// dragged.
+func scrub(width, heigh int) {
+	if !paused || dragging ||
+		!ebiten.IsMouseButtonPressed(ebiten.MouseButtonLeft) {
+		return
+	}
+	x, y := ebiten.CursorPosition()
+	if y >= heigh-timelineHeigh && width > 1 {
+		seek(float64(x) / float64(width-1))
+	}
+}
+
 func update(screen *ebiten.Image) error {
 
 	fullscreen := ebiten.IsFullscreen()
@@ -119,6 +288,91 @@ func update(screen *ebiten.Image) error {
 		return errQuit
 	}
 
+	if inpututil.IsKeyJustPressed(ebiten.KeyS) {
+		saveSnapshot()
+	}
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyR) {
+		toggleRecording()
+	}
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyG) {
+		exportClip()
+	}
+
+	if inpututil.IsKeyJustPressed(ebiten.KeySpace) {
+		togglePause()
+	}
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyLeft) {
+		step(-1)
+	}
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyRight) {
+		step(1)
+	}
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyI) {
+		inspector = !inspector
+	}
+
+	if inpututil.IsKeyJustPressed(ebiten.Key0) {
+		resetZoom()
+	}
+
+	for key, ch := range map[ebiten.Key]rune{
+		ebiten.KeyT: 't',
+		ebiten.KeyC: 'c',
+		ebiten.KeyP: 'p',
+		ebiten.KeyO: 'o',
+		ebiten.KeyA: 'a',
+		ebiten.KeyE: 'e',
+	} {
+		if inpututil.IsKeyJustPressed(key) {
+			toggleOverlay(ch)
+		}
+	}
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyTab) {
+		selectParam()
+	}
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyUp) {
+		adjustParam(1)
+	}
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyDown) {
+		adjustParam(-1)
+	}
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyM) {
+		nextCompareMode()
+	}
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyH) {
+		showHistogram = !showHistogram
+	}
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyW) {
+		showWaveform = !showWaveform
+	}
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyV) {
+		showVectorscope = !showVectorscope
+	}
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyK) {
+		toggleMaskDrawing()
+	}
+
+	if drawingMask && inpututil.IsKeyJustPressed(ebiten.KeyEnter) {
+		closeMask()
+	}
+
+	if drawingMask && inpututil.IsKeyJustPressed(ebiten.KeyBackspace) {
+		undoMask()
+	}
+
 	if inpututil.IsKeyJustPressed(ebiten.KeyF) ||
 		inpututil.IsKeyJustPressed(ebiten.KeyEscape) {
 		fullscreen = !fullscreen
@@ -146,13 +400,32 @@ func update(screen *ebiten.Image) error {
 	// screenWidth, screenHeight := screen.Size()
 	size := image.Bounds().Size()
 	ebiten.SetScreenSize(size.X, size.Y)
+	handleMouse(size.X, size.Y)
+	scrub(size.X, size.Y)
+	if drawingMask && inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
+		addMaskPoint(screenToImage(ebiten.CursorPosition()))
+	}
+	drawOverlays(image, lastFrame)
+	drawMaskOutline(image)
 
-	op := &ebiten.DrawImageOptions{}
+	op := imageOptions()
 	img, err := ebiten.NewImageFromImage(image, ebiten.FilterDefault)
 	if err != nil {
 		return err
 	}
 	screen.DrawImage(img, op)
+	if err := drawPanels(screen, size.X, size.Y); err != nil {
+		return err
+	}
+	if inspector {
+		drawInspector(screen, size.X, size.Y)
+	}
+	if paused {
+		drawTimeline(screen, size.X, size.Y)
+	} else {
+		ebitenutil.DebugPrintAt(screen, paramsText(), 0, size.Y-debugCharHeigh)
+	}
+	ebitenutil.DebugPrint(screen, status())
 
 	return nil
 }
@@ -176,12 +449,116 @@ func main() {
 	var is_ascii bool = false
 	flag.StringVar(&cameraName, "camera", cameraName, "possible values: top, bottom, depth, stereo")
 	flag.IntVar(&fps, "fps", fps, "framerate")
+	colorSpaceFlag := flag.String("colorspace", colorSpaceName(colorSpace), "possible values: rgb, bgr, yuv, yuv422, depth, distance")
 	flag.BoolVar(&is_ascii, "ascii", is_ascii, "ascii mode")
 	flag.BoolVar(&detectFaces, "face", detectFaces, "enable face detection")
-
+	flag.StringVar(&snapshotDir, "snapshot-dir", snapshotDir, "directory where snapshots are saved")
+	flag.BoolVar(&snapshotOverlay, "snapshot-overlay", snapshotOverlay, "also save the snapshot with the overlays")
+	flag.StringVar(&recordFile, "record", recordFile, "record the camera into a MJPEG AVI file or a .qvr recording")
+	flag.StringVar(&replayFile, "replay", replayFile, "replay a .qvr recording instead of connecting")
+	flag.BoolVar(&replayRealtime, "replay-realtime", replayRealtime, "replay at the recorded pace in the viewers, skipping frames if needed; dumps, y4m and clips always use every frame")
+	flag.StringVar(&castFile, "cast", castFile, "record the ascii mode into an asciicast file")
+	flag.StringVar(&htmlFile, "html", htmlFile, "export the ascii mode as an animated html page")
+	flag.StringVar(&compareURL, "compare-url", compareURL, "display a second robot next to the first one")
+	flag.StringVar(&compareReplay, "compare-replay", compareReplay, "display a .qvr recording next to the camera")
+	flag.IntVar(&pixelGridStep, "pixel-grid", pixelGridStep, "spacing in pixels of the pixel grid overlay")
+	flag.IntVar(&historySize, "history", historySize, "number of frames kept to pause and rewind")
+	flag.IntVar(&clipSeconds, "clip-seconds", clipSeconds, "duration of the GIF clips")
+	flag.IntVar(&clipWidth, "clip-width", clipWidth, "width in pixels of the GIF clips")
+	flag.StringVar(&y4mFile, "y4m", y4mFile, "write a YUV4MPEG2 stream to this file or - for stdout")
+	flag.Var(&cascadeFiles, "cascade", "pigo cascade file used for face detection, can be repeated")
+	flag.StringVar(&puplocFile, "puploc", puplocFile, "pigo pupil localization cascade file")
+	flag.StringVar(&flpcDir, "flpc", flpcDir, "directory of the pigo facial landmark cascades (requires -puploc)")
+	flag.IntVar(&faceParams.MinSize, "face-min-size", faceParams.MinSize, "minimum size of the faces in pixels")
+	flag.IntVar(&faceParams.MaxSize, "face-max-size", faceParams.MaxSize, "maximum size of the faces in pixels")
+	flag.Float64Var(&faceParams.ShiftFactor, "face-shift", faceParams.ShiftFactor, "face detection window shift factor")
+	flag.Float64Var(&faceParams.ScaleFactor, "face-scale", faceParams.ScaleFactor, "face detection window scale factor")
+	flag.Float64Var(&faceParams.IoUThreshold, "face-iou", faceParams.IoUThreshold, "overlap above which face detections are merged")
+	flag.StringVar(&privacyMode, "privacy", privacyMode, "hide the faces: pixelate, blur or box (also in snapshots and recordings)")
+	flag.Float64Var(&privacyPadding, "privacy-padding", privacyPadding, "margin around the hidden faces relatively to their size")
+	flag.StringVar(&detectionsFile, "detections-out", detectionsFile, "write the face detections of each processed frame to this JSON Lines file")
+	flag.StringVar(&galleryDir, "gallery", galleryDir, "save the best crop of each tracked face in this directory")
+	flag.Float64Var(&galleryPadding, "gallery-padding", galleryPadding, "margin around the face crops relatively to their size")
+	flag.StringVar(&occupancyFile, "occupancy-out", occupancyFile, "write the number of faces of each minute to this CSV file")
+	flag.StringVar(&maskFile, "mask", maskFile, "JSON file of the regions hidden in every frame, masks drawn with k are saved in it")
+	flag.Float64Var(&faceSweep, "face-sweep", faceSweep, "also search the faces rotated up to this angle in degrees")
+	flag.Float64Var(&faceSweepStep, "face-sweep-step", faceSweepStep, "angle in degrees between two rotations of the sweep")
+	flag.Float64Var(&cameraRoll, "camera-roll", cameraRoll, "roll of the camera in degrees, the faces are searched rotated by this angle (an offset with -camera-roll-robot)")
+	flag.BoolVar(&robotRoll, "camera-roll-robot", robotRoll, "read the roll of the camera from the inertial unit of the robot")
+	flag.IntVar(&faceFPS, "face-fps", faceFPS, "face detections per second, 0 for as fast as possible")
+	flag.BoolVar(&trackFaces, "face-track", trackFaces, "track the faces across frames")
+	flag.DurationVar(&trackTimeout, "face-track-timeout", trackTimeout, "how long a face stays tracked without being detected")
+	qThreshold := flag.Float64("face-threshold", float64(faceParams.QThreshold), "minimum score of the face detections")
+	flag.IntVar(&dumpFrames, "dump", dumpFrames, "write this number of frames to stdout and exit")
+	flag.StringVar(&dumpFormat, "dump-format", dumpFormat, "dump format: ansi, ascii, html, png, ppm")
+	flag.IntVar(&dumpWidth, "dump-width", dumpWidth, "width in characters of ansi and ascii dumps")
+
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(),
+			"Usage: %s [flags] [clip <file.gif>]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
 	flag.Parse()
 
-	var camera int32 = topCam
+	faceParams.QThreshold = float32(*qThreshold)
+	faceParams.Angles = sweepAngles(faceSweep, faceSweepStep, cameraRoll)
+	if err := faceParams.Validate(); err != nil {
+		log.Fatal(err)
+	}
+	if err := checkPrivacyMode(privacyMode); err != nil {
+		log.Fatal(err)
+	}
+	if err := checkDump(); err != nil {
+		log.Fatal(err)
+	}
+	if maskFile != "" {
+		if _, err := os.Stat(maskFile); os.IsNotExist(err) {
+			log.Printf("mask file %s not found, no masks applied", maskFile)
+		} else if err := loadMasks(maskFile); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if privacyMode != "" || detectionsFile != "" || galleryDir != "" ||
+		occupancyFile != "" {
+		detectFaces = true
+	}
+	if privacyMode != "" && !trackFaces {
+		// the tracker keeps hiding the faces the detector misses.
+		log.Fatal("-privacy requires the face tracking")
+	}
+	if occupancyFile != "" && !trackFaces {
+		log.Fatal("-occupancy-out requires the face tracking")
+	}
+	if robotRoll && (!detectFaces || replayFile != "") {
+		log.Fatal("-camera-roll-robot requires the face detection on a robot")
+	}
+	if galleryDir != "" {
+		if privacyMode != "" {
+			log.Fatal("-gallery cannot be used with -privacy")
+		}
+		if !trackFaces {
+			log.Fatal("-gallery requires the face tracking")
+		}
+		if err := openGallery(); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	clipFile := ""
+	switch flag.Arg(0) {
+	case "":
+	case "clip":
+		if flag.NArg() != 2 {
+			flag.Usage()
+			os.Exit(2)
+		}
+		clipFile = flag.Arg(1)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	camera := topCam
 	switch cameraName {
 	case "top":
 		camera = topCam
@@ -195,30 +572,141 @@ func main() {
 		log.Fatal("invalid camera argument")
 	}
 
-	sess, err := app.SessionFromFlag()
+	var err error
+	colorSpace, err = parseColorSpace(*colorSpaceFlag)
 	if err != nil {
-		log.Fatalf("failed to connect: %s", err)
+		log.Fatal(err)
 	}
 
-	videoDevice, err = ALVideoDevice(sess)
-	if err != nil {
-		log.Fatalf("failed to create video device: %s", err)
+	if historySize < clipSeconds*fps {
+		historySize = clipSeconds * fps
 	}
+	history = newFrameRing(historySize)
 
-	id, err := videoDevice.SubscribeCamera(id, camera, qvga, rgb, int32(fps))
+	if detectFaces {
+		cascades, err := loadCascades(cascadeFiles)
+		if err != nil {
+			log.Fatal(err)
+		}
+		detector = face.NewDetector(faceParams, cascades...)
+		if puplocFile != "" {
+			detector.Landmarks, err = face.NewLandmarkDetector(puplocFile, flpcDir)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+		if trackFaces {
+			tracker = face.NewTracker(trackTimeout)
+		}
+		go detectionWorker()
+	}
+
+	if clipFile != "" || dumpFrames > 0 || y4mFile != "" {
+		// the outputs must not depend on the processing time.
+		replayRealtime = false
+		syncDetection = true
+	}
+	if replayFile != "" {
+		replay, err := openReplay(replayFile, replayRealtime)
+		if err != nil {
+			log.Fatalf("failed to open replay: %s", err)
+		}
+		source = replay
+	} else {
+		sess, err := app.SessionFromFlag()
+		if err != nil {
+			log.Fatalf("failed to connect: %s", err)
+		}
+
+		videoDevice, err := ALVideoDevice(sess)
+		if err != nil {
+			log.Fatalf("failed to create video device: %s", err)
+		}
+
+		source, err = subscribe(videoDevice, camera)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if robotRoll {
+			memory, err := ALMemory(sess)
+			if err != nil {
+				log.Fatalf("failed to create memory: %s", err)
+			}
+			go watchRoll(memory)
+		}
+	}
+	defer source.Close()
+
+	compareSource, err = openCompareSource(camera)
 	if err != nil {
-		videoDevice.Unsubscribe(id)
-		log.Fatalf("failed to initialize camera: %s", err)
+		source.Close()
+		log.Fatal(err)
+	}
+	if compareSource != nil {
+		compareHistory = newFrameRing(historySize)
+		if tracker != nil {
+			compareTracker = face.NewTracker(trackTimeout)
+		}
+		defer compareSource.Close()
+	}
+
+	if recordFile != "" {
+		startRecording(recordFile)
+	}
+	if detectionsFile != "" {
+		if err := openDetectionsOut(detectionsFile); err != nil {
+			source.Close()
+			log.Fatal(err)
+		}
+	}
+	if occupancyFile != "" {
+		if err := openOccupancy(occupancyFile); err != nil {
+			source.Close()
+			log.Fatal(err)
+		}
 	}
-	defer videoDevice.Unsubscribe(id)
 
-	if is_ascii {
+	// finalize the recording when interrupted.
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		<-interrupt
+		if err := stopRecording(); err != nil {
+			log.Printf("recording: %s", err)
+		}
+		if err := closeDetectionsOut(); err != nil {
+			log.Printf("detections output: %s", err)
+		}
+		if err := closeOccupancy(); err != nil {
+			log.Printf("occupancy output: %s", err)
+		}
+		source.Close()
+		os.Exit(1)
+	}()
+
+	if clipFile != "" {
+		err = captureClip(clipFile)
+	} else if dumpFrames > 0 {
+		err = dump(os.Stdout)
+	} else if y4mFile != "" {
+		err = streamY4M()
+	} else if is_ascii {
 		err = ascii()
 	} else {
 		err = gui()
 	}
+	if err := stopRecording(); err != nil {
+		log.Printf("recording: %s", err)
+	}
+	if err := closeDetectionsOut(); err != nil {
+		log.Printf("detections output: %s", err)
+	}
+	if err := closeOccupancy(); err != nil {
+		log.Printf("occupancy output: %s", err)
+	}
 	if err != nil {
-		videoDevice.Unsubscribe(id)
+		source.Close()
 		log.Fatal(err)
 	}
 }
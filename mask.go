@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+// mask is a polygon hidden in every frame. The coordinates are
+// relative to the frame size so that a mask works at any resolution.
+type mask struct {
+	Name   string       `json:"name,omitempty"`
+	Points [][2]float64 `json:"points"`
+}
+
+// maskConfig is the content of a mask file.
+type maskConfig struct {
+	Masks []mask `json:"masks"`
+}
+
+var (
+	maskFile = ""
+	masks    []mask
+
+	// drawingMask is true when the clicks add the points of a new
+	// mask, the points are stored in maskPoints.
+	drawingMask = false
+	maskPoints  [][2]float64
+
+	maskOutlineColor = color.RGBA{0xff, 0xff, 0x00, 0xff}
+)
+
+// loadMasks reads the masks of a mask file.
+func loadMasks(file string) error {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("read masks: %s", err)
+	}
+	var config maskConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return fmt.Errorf("parse masks %s: %s", file, err)
+	}
+	for i, m := range config.Masks {
+		if len(m.Points) < 3 {
+			return fmt.Errorf("mask %d of %s: less than 3 points", i, file)
+		}
+	}
+	masks = config.Masks
+	return nil
+}
+
+// saveMasks writes the masks to maskFile, or to a file in snapshotDir
+// if no mask file was given. It returns the name of the file.
+func saveMasks() (string, error) {
+	file := maskFile
+	if file == "" {
+		if err := os.MkdirAll(snapshotDir, 0755); err != nil {
+			return "", fmt.Errorf("snapshot directory: %s", err)
+		}
+		file = filepath.Join(snapshotDir, "qiview-masks.json")
+	}
+	data, err := json.MarshalIndent(maskConfig{masks}, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := ioutil.WriteFile(file, data, 0644); err != nil {
+		return "", fmt.Errorf("save masks: %s", err)
+	}
+	return file, nil
+}
+
+// inside tests if (x, y) is inside the polygon with the even-odd
+// rule.
+func inside(points [][2]float64, x, y float64) bool {
+	in := false
+	j := len(points) - 1
+	for i := range points {
+		xi, yi := points[i][0], points[i][1]
+		xj, yj := points[j][0], points[j][1]
+		if (yi > y) != (yj > y) && x < (xj-xi)*(y-yi)/(yj-yi)+xi {
+			in = !in
+		}
+		j = i
+	}
+	return in
+}
+
+// fillMask paints the pixels of img inside m in black.
+func fillMask(img *imageRGB, m mask) {
+	w, h := float64(img.width), float64(img.heigh)
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for _, p := range m.Points {
+		minX, maxX = math.Min(minX, p[0]), math.Max(maxX, p[0])
+		minY, maxY = math.Min(minY, p[1]), math.Max(maxY, p[1])
+	}
+	bounds := image.Rect(int(minX*w), int(minY*h),
+		int(math.Ceil(maxX*w)), int(math.Ceil(maxY*h))).Intersect(img.Bounds())
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			// test the center of the pixel.
+			if inside(m.Points, (float64(x)+0.5)/w, (float64(y)+0.5)/h) {
+				i := 3 * (y*img.width + x)
+				img.pixels[i], img.pixels[i+1], img.pixels[i+2] = 0, 0, 0
+			}
+		}
+	}
+}
+
+// applyMasks returns an rgb frame where the masks are hidden, or the
+// frame itself if there is no mask.
+func applyMasks(frame *Frame) *Frame {
+	if len(masks) == 0 {
+		return frame
+	}
+	img := frame.Image()
+	for _, m := range masks {
+		fillMask(img, m)
+	}
+	return rgbFrame(frame, img)
+}
+
+// toggleMaskDrawing starts or cancels the drawing of a mask.
+func toggleMaskDrawing() {
+	drawingMask = !drawingMask
+	maskPoints = nil
+	if drawingMask {
+		notify("click the corners of the mask, enter to add it, backspace to remove a point")
+	} else {
+		notify("mask drawing cancelled")
+	}
+}
+
+// addMaskPoint adds the pixel (x, y) of the displayed image to the
+// mask being drawn.
+func addMaskPoint(x, y int) {
+	if lastRaw == nil || x < 0 || y < 0 ||
+		x >= lastRaw.width || y >= lastRaw.heigh {
+		return
+	}
+	maskPoints = append(maskPoints, [2]float64{
+		(float64(x) + 0.5) / float64(lastRaw.width),
+		(float64(y) + 0.5) / float64(lastRaw.heigh),
+	})
+}
+
+// closeMask adds the mask being drawn and saves the masks.
+func closeMask() {
+	if len(maskPoints) < 3 {
+		notify("a mask needs at least 3 points")
+		return
+	}
+	masks = append(masks, mask{Points: maskPoints})
+	drawingMask, maskPoints = false, nil
+	file, err := saveMasks()
+	if err != nil {
+		notify("%s", err)
+		return
+	}
+	notify("mask saved in %s", file)
+}
+
+// undoMask removes the last point of the mask being drawn. The saved
+// masks are only removed by editing the mask file.
+func undoMask() {
+	if len(maskPoints) != 0 {
+		maskPoints = maskPoints[:len(maskPoints)-1]
+	}
+}
+
+// line draws a segment between two points of the frame.
+func (c canvas) line(x0, y0, x1, y1 float64, col color.Color) {
+	ax, ay := c.scale(x0, y0)
+	bx, by := c.scale(x1, y1)
+	steps := int(math.Max(math.Abs(float64(bx-ax)), math.Abs(float64(by-ay))))
+	if steps == 0 {
+		c.img.Set(ax, ay, col)
+		return
+	}
+	for i := 0; i <= steps; i++ {
+		c.img.Set(ax+(bx-ax)*i/steps, ay+(by-ay)*i/steps, col)
+	}
+}
+
+// drawMaskOutline draws the mask being drawn on the displayed image.
+func drawMaskOutline(img draw.Image) {
+	if !drawingMask || len(maskPoints) == 0 {
+		return
+	}
+	c := canvas{
+		img:   img,
+		area:  displayRegions(img.Bounds())[0],
+		width: 1,
+		heigh: 1,
+	}
+	for i, p := range maskPoints {
+		// the last point is joined to the first one.
+		q := maskPoints[(i+1)%len(maskPoints)]
+		c.line(p[0], p[1], q[0], q[1], maskOutlineColor)
+	}
+}
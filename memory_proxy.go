@@ -0,0 +1,72 @@
+// Package main contains a generated proxy
+// .
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	bus "github.com/lugu/qiloop/bus"
+	basic "github.com/lugu/qiloop/type/basic"
+	value "github.com/lugu/qiloop/type/value"
+)
+
+// ALMemoryProxy represents a proxy object to the service
+type ALMemoryProxy interface {
+	GetData(name string) (value.Value, error)
+	// Generic methods shared by all objectsProxy
+	bus.ObjectProxy
+	// WithContext can be used cancellation and timeout
+	WithContext(ctx context.Context) ALMemoryProxy
+}
+
+// proxyALMemory implements ALMemoryProxy
+type proxyALMemory struct {
+	bus.ObjectProxy
+	session bus.Session
+}
+
+// MakeALMemory returns a specialized proxy.
+func MakeALMemory(sess bus.Session, proxy bus.Proxy) ALMemoryProxy {
+	return &proxyALMemory{bus.MakeObject(proxy), sess}
+}
+
+// ALMemory returns a proxy to a remote service
+func ALMemory(session bus.Session) (ALMemoryProxy, error) {
+	proxy, err := session.Proxy("ALMemory", 1)
+	if err != nil {
+		return nil, fmt.Errorf("contact service: %s", err)
+	}
+	return MakeALMemory(session, proxy), nil
+}
+
+// WithContext bound future calls to the context deadline and cancellation
+func (p *proxyALMemory) WithContext(ctx context.Context) ALMemoryProxy {
+	return MakeALMemory(p.session, p.Proxy().WithContext(ctx))
+}
+
+// GetData calls the remote procedure
+func (p *proxyALMemory) GetData(name string) (value.Value, error) {
+	var err error
+	var ret value.Value
+	var buf bytes.Buffer
+	if err = basic.WriteString(name, &buf); err != nil {
+		return ret, fmt.Errorf("serialize name: %s", err)
+	}
+	methodID, _, err := p.Proxy().MetaObject().MethodID("getData", "(s)")
+	if err != nil {
+		return ret, err
+	}
+	response, err := p.Proxy().CallID(methodID, buf.Bytes())
+	if err != nil {
+		return ret, fmt.Errorf("call getData failed: %s", err)
+	}
+	resp := bytes.NewBuffer(response)
+	ret, err = value.NewValue(resp)
+	if err != nil {
+		return ret, fmt.Errorf("parse getData response: %s", err)
+	}
+	return ret, nil
+}
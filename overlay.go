@@ -0,0 +1,182 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+var (
+	showThirds    = false
+	showCrosshair = false
+	showPixelGrid = false
+	showHorizon   = false
+	showSafeAreas = false
+	pixelGridStep = 10
+
+	thirdsColor    = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	crosshairColor = color.RGBA{0xff, 0x00, 0x00, 0xff}
+	pixelGridColor = color.RGBA{0x80, 0x80, 0x80, 0xff}
+	horizonColor   = color.RGBA{0x00, 0xff, 0xff, 0xff}
+	safeAreaColor  = color.RGBA{0xff, 0xff, 0x00, 0xff}
+)
+
+// the safe areas are centered and cover these fractions of the width
+// and height of the frame (SMPTE ST 2046-1).
+const (
+	actionSafe = 0.93
+	titleSafe  = 0.90
+)
+
+// canvas draws lines on the area of an image which displays a
+// frame, possibly at a different size.
+type canvas struct {
+	img          draw.Image
+	area         image.Rectangle
+	width, heigh int // size of the frame
+}
+
+// scale converts frame coordinates into image coordinates.
+func (c canvas) scale(x, y float64) (int, int) {
+	size := c.area.Size()
+	return c.area.Min.X + int(x*float64(size.X)/float64(c.width)),
+		c.area.Min.Y + int(y*float64(size.Y)/float64(c.heigh))
+}
+
+// hLine draws the line y of the frame.
+func (c canvas) hLine(y float64, col color.Color) {
+	_, iy := c.scale(0, y)
+	for x := c.area.Min.X; x < c.area.Max.X; x++ {
+		c.img.Set(x, iy, col)
+	}
+}
+
+// vLine draws the column x of the frame.
+func (c canvas) vLine(x float64, col color.Color) {
+	ix, _ := c.scale(x, 0)
+	for y := c.area.Min.Y; y < c.area.Max.Y; y++ {
+		c.img.Set(ix, y, col)
+	}
+}
+
+// centeredRect draws the rectangle of the frame centered and covering the
+// given fraction of its size.
+func (c canvas) centeredRect(fraction float64, col color.Color) {
+	w, h := float64(c.width), float64(c.heigh)
+	mx, my := w*(1-fraction)/2, h*(1-fraction)/2
+	x0, y0 := c.scale(mx, my)
+	x1, y1 := c.scale(w-mx, h-my)
+	for x := x0; x <= x1; x++ {
+		c.img.Set(x, y0, col)
+		c.img.Set(x, y1, col)
+	}
+	for y := y0; y <= y1; y++ {
+		c.img.Set(x0, y, col)
+		c.img.Set(x1, y, col)
+	}
+}
+
+// horizonRow returns the row of the frame where the vertical angle
+// is zero. The top and bottom angles are positive above the camera
+// axis.
+func horizonRow(frame *Frame) (float64, bool) {
+	top, bottom := frame.Angles[1], frame.Angles[3]
+	if top == bottom {
+		return 0, false
+	}
+	row := top / (top - bottom) * float64(frame.Height)
+	if row < 0 || row >= float64(frame.Height) {
+		return 0, false
+	}
+	return row, true
+}
+
+// drawOverlays draws the enabled overlays on img which displays
+// frame. When two sources are side by side, both are decorated but
+// the heatmap, which describes the faces of the first one only.
+func drawOverlays(img draw.Image, frame *Frame) {
+	if frame.Width == 0 || frame.Height == 0 {
+		return
+	}
+	for i, area := range displayRegions(img.Bounds()) {
+		c := canvas{
+			img:   img,
+			area:  area,
+			width: frame.Width,
+			heigh: frame.Height,
+		}
+		if showHeatmap && i == 0 {
+			c.heatmap()
+		}
+		c.draw(frame)
+	}
+}
+
+func (c canvas) draw(frame *Frame) {
+	w, h := float64(frame.Width), float64(frame.Height)
+	if showPixelGrid && pixelGridStep > 0 {
+		// skip the grid when the lines would be too close.
+		if sx, _ := c.scale(float64(pixelGridStep), 0); sx-c.area.Min.X >= 2 {
+			for x := pixelGridStep; x < frame.Width; x += pixelGridStep {
+				c.vLine(float64(x), pixelGridColor)
+			}
+			for y := pixelGridStep; y < frame.Height; y += pixelGridStep {
+				c.hLine(float64(y), pixelGridColor)
+			}
+		}
+	}
+	if showThirds {
+		c.vLine(w/3, thirdsColor)
+		c.vLine(2*w/3, thirdsColor)
+		c.hLine(h/3, thirdsColor)
+		c.hLine(2*h/3, thirdsColor)
+	}
+	if showHorizon {
+		if row, ok := horizonRow(frame); ok {
+			c.hLine(row, horizonColor)
+		}
+	}
+	if showSafeAreas {
+		c.centeredRect(actionSafe, safeAreaColor)
+		c.centeredRect(titleSafe, safeAreaColor)
+	}
+	if showCrosshair {
+		// a cross of a fifth of the frame.
+		cx, cy := c.scale(w/2, h/2)
+		x0, y0 := c.scale(0.4*w, 0.4*h)
+		x1, y1 := c.scale(0.6*w, 0.6*h)
+		for x := x0; x <= x1; x++ {
+			c.img.Set(x, cy, crosshairColor)
+		}
+		for y := y0; y <= y1; y++ {
+			c.img.Set(cx, y, crosshairColor)
+		}
+	}
+}
+
+// toggleOverlay switches the overlay associated with a key. It
+// returns false if the key is not associated with an overlay.
+func toggleOverlay(key rune) bool {
+	switch key {
+	case 't':
+		showThirds = !showThirds
+	case 'c':
+		showCrosshair = !showCrosshair
+	case 'p':
+		showPixelGrid = !showPixelGrid
+	case 'e':
+		showSafeAreas = !showSafeAreas
+	case 'a':
+		showHeatmap = !showHeatmap
+	case 'o':
+		showHorizon = !showHorizon
+		if showHorizon && lastFrame != nil {
+			if _, ok := horizonRow(lastFrame); !ok {
+				notify("horizon not visible")
+			}
+		}
+	default:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+var (
+	historySize = 300
+
+	// when paused, the viewer displays pausedFrame while the frames
+	// keep being received. position is the number of the paused frame
+	// counted since the start, it locates it in the history.
+	paused        = false
+	position      = 0
+	pausedFrame   *Frame
+	comparePaused *Frame
+)
+
+// positionIndex returns the index in the history of the paused frame,
+// 0 if it is no longer in the history.
+func positionIndex() int {
+	i := position - history.Dropped()
+	if i < 0 {
+		i = 0
+	}
+	if last := history.Len() - 1; i > last {
+		i = last
+	}
+	return i
+}
+
+// pauseAt pauses on the frame i of the history, kept within the
+// history. The paused frames are kept even when they are dropped from
+// the history.
+func pauseAt(i int) {
+	if i < 0 {
+		i = 0
+	}
+	if last := history.Len() - 1; i > last {
+		i = last
+	}
+	paused = true
+	position = history.Dropped() + i
+	pausedFrame = history.At(i)
+	comparePaused = nil
+	if compareHistory != nil {
+		comparePaused = compareHistory.At(i)
+	}
+}
+
+// togglePause pauses on the last frame or resumes the live view.
+func togglePause() {
+	if paused {
+		paused = false
+		pausedFrame, comparePaused = nil, nil
+		return
+	}
+	pauseAt(history.Len() - 1)
+}
+
+// step pauses and moves n frames forward (or backward if n is
+// negative) from the paused frame.
+func step(n int) {
+	if !paused {
+		togglePause()
+	}
+	i := position - history.Dropped()
+	if i < 0 && n < 0 {
+		// the paused frame is older than the history.
+		return
+	}
+	pauseAt(i + n)
+}
+
+// seek pauses on the frame at fraction (0 to 1) of the history.
+func seek(fraction float64) {
+	pauseAt(int(fraction*float64(history.Len()-1) + 0.5))
+}
+
+// displayedFrame returns the frame to display given the last frame
+// received.
+func displayedFrame(latest *Frame) *Frame {
+	if !paused || pausedFrame == nil {
+		return latest
+	}
+	return pausedFrame
+}
+
+// timelineText returns a timeline width characters wide, such as:
+// [=====|----] 12/300
+func timelineText(width int) string {
+	count := history.Len()
+	label := fmt.Sprintf(" %d/%d", positionIndex()+1, count)
+	bar := width - len(label) - 2
+	if bar < 1 || count == 0 {
+		return label
+	}
+	cursor := 0
+	if count > 1 {
+		cursor = positionIndex() * (bar - 1) / (count - 1)
+	}
+	return "[" + strings.Repeat("=", cursor) + "|" +
+		strings.Repeat("-", bar-cursor-1) + "]" + label
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"time"
+
+	"github.com/lugu/qiview/face"
+)
+
+var (
+	// privacyMode hides the faces: "pixelate", "blur" or "box". It
+	// is empty when the faces are visible.
+	privacyMode = ""
+	// privacyPadding enlarges the hidden area around each face,
+	// relatively to the size of the face.
+	privacyPadding = 0.25
+)
+
+func checkPrivacyMode(mode string) error {
+	switch mode {
+	case "", "pixelate", "blur", "box":
+		return nil
+	}
+	return fmt.Errorf("invalid privacy mode: %s", mode)
+}
+
+// anonymize returns an rgb frame where the faces are hidden. The
+// faces are detected on every frame, unlike the display detection,
+// and the tracker keeps hiding a face when a detection is missed.
+func anonymize(frame *Frame) *Frame {
+	return hideFaces(frame, detect(frame, time.Now()))
+}
+
+// anonymizeCompare hides the faces of a frame of the second source.
+// Its faces are tracked separately and not reported.
+func anonymizeCompare(frame *Frame) *Frame {
+	return hideFaces(frame, findFaces(frame, compareTracker))
+}
+
+// hideFaces returns an rgb copy of frame where the faces are hidden.
+// The smoothed box of the tracker lags behind a moving face: the box
+// of the detection is hidden too.
+func hideFaces(frame *Frame, faces []face.Detection) *Frame {
+	img := frame.Image()
+	for _, f := range faces {
+		box := f.Box.Union(f.Detected)
+		hide(img, padded(box, privacyPadding).Intersect(img.Bounds()))
+	}
+	return rgbFrame(frame, img)
+}
+
+// padded enlarges box by padding times its size on each side.
+func padded(box image.Rectangle, padding float64) image.Rectangle {
+	dx := int(padding * float64(box.Dx()))
+	dy := int(padding * float64(box.Dy()))
+	return image.Rect(box.Min.X-dx, box.Min.Y-dy, box.Max.X+dx, box.Max.Y+dy)
+}
+
+// hide applies privacyMode to the area r of img.
+func hide(img *imageRGB, r image.Rectangle) {
+	if r.Empty() {
+		return
+	}
+	switch privacyMode {
+	case "pixelate":
+		// about eight blocks across the face.
+		pixelate(img, r, clampInt(r.Dx()/8, 4, r.Dx()))
+	case "blur":
+		blur(img, r, clampInt(r.Dx()/6, 2, r.Dx()))
+	default:
+		fill(img, r)
+	}
+}
+
+// fill paints r in black.
+func fill(img *imageRGB, r image.Rectangle) {
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		i := 3 * (y*img.width + r.Min.X)
+		j := 3 * (y*img.width + r.Max.X)
+		for k := i; k < j; k++ {
+			img.pixels[k] = 0
+		}
+	}
+}
+
+// pixelate replaces each block of r by its average color.
+func pixelate(img *imageRGB, r image.Rectangle, block int) {
+	for by := r.Min.Y; by < r.Max.Y; by += block {
+		for bx := r.Min.X; bx < r.Max.X; bx += block {
+			b := image.Rect(bx, by, bx+block, by+block).Intersect(r)
+			var sum [3]int
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					i := 3 * (y*img.width + x)
+					for c := range sum {
+						sum[c] += int(img.pixels[i+c])
+					}
+				}
+			}
+			n := b.Dx() * b.Dy()
+			for y := b.Min.Y; y < b.Max.Y; y++ {
+				for x := b.Min.X; x < b.Max.X; x++ {
+					i := 3 * (y*img.width + x)
+					for c := range sum {
+						img.pixels[i+c] = byte(sum[c] / n)
+					}
+				}
+			}
+		}
+	}
+}
+
+// blur applies a box blur of the given radius to r, horizontally
+// then vertically. Three passes hide the features of a face.
+func blur(img *imageRGB, r image.Rectangle, radius int) {
+	for pass := 0; pass < 3; pass++ {
+		blurLine(img, r, radius, 3, 3*img.width)
+		blurLine(img, r, radius, 3*img.width, 3)
+	}
+}
+
+// blurLine averages the pixels of r along one direction: step is the
+// offset between two pixels of a line and next the offset between
+// two lines.
+func blurLine(img *imageRGB, r image.Rectangle, radius, step, next int) {
+	length, lines := r.Dx(), r.Dy()
+	if step != 3 {
+		length, lines = r.Dy(), r.Dx()
+	}
+	start := 3 * (r.Min.Y*img.width + r.Min.X)
+	line := make([]byte, 3*length)
+	for l := 0; l < lines; l++ {
+		first := start + l*next
+		for k := 0; k < length; k++ {
+			copy(line[3*k:3*k+3], img.pixels[first+k*step:])
+		}
+		for k := 0; k < length; k++ {
+			lo := k - radius
+			if lo < 0 {
+				lo = 0
+			}
+			hi := k + radius
+			if hi >= length {
+				hi = length - 1
+			}
+			var sum [3]int
+			for m := lo; m <= hi; m++ {
+				for c := range sum {
+					sum[c] += int(line[3*m+c])
+				}
+			}
+			for c := range sum {
+				img.pixels[first+k*step+c] = byte(sum[c] / (hi - lo + 1))
+			}
+		}
+	}
+}
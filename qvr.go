@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// A qiview recording (.qvr) stores the frames exactly as received.
+//
+// The file starts with the magic "QVR\x00" followed by the version
+// (uint32). It is then a sequence of chunks: a 4 bytes tag, the size
+// of the payload (uint32) and the payload. All integers are little
+// endian.
+//
+// FRAM chunks contain a frame: the timestamp in nanoseconds (int64),
+// the width, height, number of layers, color space and camera id
+// (int32), the left, top, right and bottom angles (float64) and the
+// pixels.
+//
+// When the recording is closed, an INDX chunk lists the position and
+// the timestamp (int64) of each FRAM chunk and a final TAIL chunk
+// contains the position of the INDX chunk (int64). Files without
+// index (interrupted recordings) are scanned when opened.
+const (
+	qvrMagic      = "QVR\x00"
+	qvrVersion    = 1
+	qvrHeaderSize = 8
+	qvrChunkSize  = 8
+	qvrFrameSize  = 8 + 5*4 + 4*8
+	qvrTailSize   = qvrChunkSize + 8
+)
+
+type qvrIndexEntry struct {
+	Offset    int64
+	Timestamp int64
+}
+
+// frameHeader is the fixed size part of a FRAM chunk.
+type frameHeader struct {
+	Timestamp  int64
+	Width      int32
+	Height     int32
+	Layers     int32
+	ColorSpace int32
+	Camera     int32
+	Angles     [4]float64
+}
+
+// qvrWriter writes a qiview recording.
+type qvrWriter struct {
+	file   *os.File
+	out    *bufio.Writer
+	offset int64
+	index  []qvrIndexEntry
+}
+
+func newQVRWriter(filename string) (*qvrWriter, error) {
+	file, err := os.Create(filename)
+	if err != nil {
+		return nil, fmt.Errorf("create recording: %s", err)
+	}
+	q := &qvrWriter{
+		file: file,
+		out:  bufio.NewWriter(file),
+	}
+	if err := q.write([]byte(qvrMagic), uint32(qvrVersion)); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return q, nil
+}
+
+func (q *qvrWriter) write(data ...interface{}) error {
+	for _, d := range data {
+		if err := binary.Write(q.out, binary.LittleEndian, d); err != nil {
+			return err
+		}
+		q.offset += int64(binary.Size(d))
+	}
+	return nil
+}
+
+// WriteFrame appends a FRAM chunk.
+func (q *qvrWriter) WriteFrame(frame *Frame) error {
+	header := frameHeader{
+		Timestamp:  frame.Timestamp.UnixNano(),
+		Width:      int32(frame.Width),
+		Height:     int32(frame.Height),
+		Layers:     int32(frame.Layers),
+		ColorSpace: int32(frame.ColorSpace),
+		Camera:     int32(frame.Camera),
+		Angles:     frame.Angles,
+	}
+	q.index = append(q.index, qvrIndexEntry{
+		Offset:    q.offset,
+		Timestamp: header.Timestamp,
+	})
+	size := uint32(qvrFrameSize + len(frame.Pixels))
+	return q.write([]byte("FRAM"), size, header, frame.Pixels)
+}
+
+// Close writes the index and closes the file.
+func (q *qvrWriter) Close() error {
+	indexOffset := q.offset
+	err := q.write([]byte("INDX"), uint32(16*len(q.index)), q.index)
+	if err == nil {
+		err = q.write([]byte("TAIL"), uint32(8), indexOffset)
+	}
+	if err == nil {
+		err = q.out.Flush()
+	}
+	if closeErr := q.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// qvrReader gives random access to the frames of a recording.
+type qvrReader struct {
+	file  *os.File
+	index []qvrIndexEntry
+}
+
+func openQVR(filename string) (*qvrReader, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("open recording: %s", err)
+	}
+	q := &qvrReader{
+		file: file,
+	}
+	if err := q.readHeader(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%s: %s", filename, err)
+	}
+	if err := q.readIndex(); err != nil {
+		if err := q.scan(); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("%s: %s", filename, err)
+		}
+	}
+	if len(q.index) == 0 {
+		file.Close()
+		return nil, fmt.Errorf("%s: empty recording", filename)
+	}
+	return q, nil
+}
+
+func (q *qvrReader) readHeader() error {
+	var header struct {
+		Magic   [4]byte
+		Version uint32
+	}
+	if err := binary.Read(q.file, binary.LittleEndian, &header); err != nil {
+		return fmt.Errorf("read header: %s", err)
+	}
+	if string(header.Magic[:]) != qvrMagic {
+		return fmt.Errorf("not a qiview recording")
+	}
+	if header.Version != qvrVersion {
+		return fmt.Errorf("unsupported version: %d", header.Version)
+	}
+	return nil
+}
+
+// readChunk reads the chunk header at offset.
+func (q *qvrReader) readChunk(offset int64) (string, uint32, error) {
+	var chunk struct {
+		Tag  [4]byte
+		Size uint32
+	}
+	r := io.NewSectionReader(q.file, offset, qvrChunkSize)
+	if err := binary.Read(r, binary.LittleEndian, &chunk); err != nil {
+		return "", 0, err
+	}
+	return string(chunk.Tag[:]), chunk.Size, nil
+}
+
+// readIndex loads the index using the TAIL chunk.
+func (q *qvrReader) readIndex() error {
+	info, err := q.file.Stat()
+	if err != nil {
+		return err
+	}
+	tail := info.Size() - qvrTailSize
+	if tail < qvrHeaderSize {
+		return fmt.Errorf("missing index")
+	}
+	tag, _, err := q.readChunk(tail)
+	if err != nil {
+		return err
+	} else if tag != "TAIL" {
+		return fmt.Errorf("missing index")
+	}
+	var indexOffset int64
+	r := io.NewSectionReader(q.file, tail+qvrChunkSize, 8)
+	if err := binary.Read(r, binary.LittleEndian, &indexOffset); err != nil {
+		return err
+	}
+	tag, size, err := q.readChunk(indexOffset)
+	if err != nil {
+		return err
+	} else if tag != "INDX" {
+		return fmt.Errorf("invalid index")
+	}
+	q.index = make([]qvrIndexEntry, size/16)
+	r = io.NewSectionReader(q.file, indexOffset+qvrChunkSize, int64(size))
+	return binary.Read(r, binary.LittleEndian, q.index)
+}
+
+// scan builds the index by reading the chunks one by one. It stops at
+// the first incomplete chunk.
+func (q *qvrReader) scan() error {
+	info, err := q.file.Stat()
+	if err != nil {
+		return err
+	}
+	q.index = nil
+	offset := int64(qvrHeaderSize)
+	for offset+qvrChunkSize+qvrFrameSize <= info.Size() {
+		tag, size, err := q.readChunk(offset)
+		if err != nil {
+			return err
+		}
+		next := offset + qvrChunkSize + int64(size)
+		if next > info.Size() {
+			break
+		}
+		if tag == "FRAM" {
+			var timestamp int64
+			r := io.NewSectionReader(q.file, offset+qvrChunkSize, 8)
+			if err := binary.Read(r, binary.LittleEndian, &timestamp); err != nil {
+				return err
+			}
+			q.index = append(q.index, qvrIndexEntry{
+				Offset:    offset,
+				Timestamp: timestamp,
+			})
+		}
+		offset = next
+	}
+	return nil
+}
+
+// Len returns the number of frames.
+func (q *qvrReader) Len() int {
+	return len(q.index)
+}
+
+// Timestamp returns the timestamp of the frame i.
+func (q *qvrReader) Timestamp(i int) time.Time {
+	return time.Unix(0, q.index[i].Timestamp)
+}
+
+// Frame reads the frame i.
+func (q *qvrReader) Frame(i int) (*Frame, error) {
+	offset := q.index[i].Offset
+	tag, size, err := q.readChunk(offset)
+	if err != nil {
+		return nil, fmt.Errorf("read frame %d: %s", i, err)
+	} else if tag != "FRAM" || size < qvrFrameSize {
+		return nil, fmt.Errorf("invalid frame %d", i)
+	}
+	data := make([]byte, size)
+	if _, err := q.file.ReadAt(data, offset+qvrChunkSize); err != nil {
+		return nil, fmt.Errorf("read frame %d: %s", i, err)
+	}
+	var header frameHeader
+	err = binary.Read(bytes.NewReader(data), binary.LittleEndian, &header)
+	if err != nil {
+		return nil, fmt.Errorf("read frame %d: %s", i, err)
+	}
+	return &Frame{
+		Width:      int(header.Width),
+		Height:     int(header.Height),
+		Layers:     int(header.Layers),
+		ColorSpace: int(header.ColorSpace),
+		Timestamp:  time.Unix(0, header.Timestamp),
+		Camera:     int(header.Camera),
+		Angles:     header.Angles,
+		Pixels:     data[qvrFrameSize:],
+	}, nil
+}
+
+// Close closes the file.
+func (q *qvrReader) Close() error {
+	return q.file.Close()
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testFrames returns n frames with distinct pixels and metadata.
+func testFrames(n int) []*Frame {
+	frames := make([]*Frame, n)
+	start := time.Unix(1600000000, 0)
+	for i := range frames {
+		pixels := make([]byte, 4*3*3)
+		for j := range pixels {
+			pixels[j] = byte(i*len(pixels) + j)
+		}
+		frames[i] = &Frame{
+			Width:      4,
+			Height:     3,
+			Layers:     3,
+			ColorSpace: 11,
+			Timestamp:  start.Add(time.Duration(i) * 40 * time.Millisecond),
+			Camera:     i % 2,
+			Angles:     [4]float64{0.1, 0.2, float64(i), 0.4},
+			Pixels:     pixels,
+		}
+	}
+	return frames
+}
+
+// writeTestRecording records frames into a new file of dir.
+func writeTestRecording(t *testing.T, dir string, frames []*Frame) string {
+	filename := filepath.Join(dir, "test.qvr")
+	w, err := newQVRWriter(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, frame := range frames {
+		if err := w.WriteFrame(frame); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func checkFrame(t *testing.T, i int, got, want *Frame) {
+	if got.Width != want.Width || got.Height != want.Height ||
+		got.Layers != want.Layers || got.ColorSpace != want.ColorSpace ||
+		got.Camera != want.Camera || got.Angles != want.Angles ||
+		!got.Timestamp.Equal(want.Timestamp) {
+		t.Errorf("frame %d: got %+v, want %+v", i, got, want)
+	}
+	if !bytes.Equal(got.Pixels, want.Pixels) {
+		t.Errorf("frame %d: pixels differ", i)
+	}
+}
+
+func TestQVRRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "qvr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	frames := testFrames(5)
+	q, err := openQVR(writeTestRecording(t, dir, frames))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	if q.Len() != len(frames) {
+		t.Fatalf("got %d frames, want %d", q.Len(), len(frames))
+	}
+	for i, want := range frames {
+		if !q.Timestamp(i).Equal(want.Timestamp) {
+			t.Errorf("timestamp %d: got %s, want %s", i,
+				q.Timestamp(i), want.Timestamp)
+		}
+		got, err := q.Frame(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkFrame(t, i, got, want)
+	}
+}
+
+func TestQVRTruncated(t *testing.T) {
+	dir, err := ioutil.TempDir("", "qvr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	frames := testFrames(5)
+	filename := writeTestRecording(t, dir, frames)
+	info, err := os.Stat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// remove the TAIL and INDX chunks and half of the last frame, as
+	// if the recording was interrupted.
+	index := int64(qvrChunkSize + 16*len(frames))
+	frameSize := int64(qvrChunkSize + qvrFrameSize + len(frames[0].Pixels))
+	size := info.Size() - qvrTailSize - index - frameSize/2
+	if err := os.Truncate(filename, size); err != nil {
+		t.Fatal(err)
+	}
+
+	q, err := openQVR(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	if q.Len() != len(frames)-1 {
+		t.Fatalf("got %d frames, want %d", q.Len(), len(frames)-1)
+	}
+	for i := 0; i < q.Len(); i++ {
+		got, err := q.Frame(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkFrame(t, i, got, frames[i])
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	recordFile = ""
+
+	// recording is nil when no recording is in progress.
+	recording      frameWriter
+	recordingFile  string
+	recordingMutex sync.Mutex
+)
+
+// frameWriter is implemented by the recording formats.
+type frameWriter interface {
+	WriteFrame(frame *Frame) error
+	Close() error
+}
+
+// newFrameWriter creates a recording file: a qiview recording if the
+// file name ends with .qvr and a MJPEG AVI file otherwise.
+func newFrameWriter(filename string, frame *Frame) (frameWriter, error) {
+	if filepath.Ext(filename) == ".qvr" {
+		return newQVRWriter(filename)
+	}
+	return newAVIWriter(filename, frame.Width, frame.Height, fps)
+}
+
+// startRecording starts recording the frames into filename.
+// The file is created when the first frame is received.
+func startRecording(filename string) {
+	recordingMutex.Lock()
+	defer recordingMutex.Unlock()
+	recordingFile = filename
+}
+
+// stopRecording finalizes the file being recorded.
+func stopRecording() error {
+	recordingMutex.Lock()
+	defer recordingMutex.Unlock()
+	recordingFile = ""
+	if recording == nil {
+		return nil
+	}
+	err := recording.Close()
+	recording = nil
+	return err
+}
+
+func isRecording() bool {
+	recordingMutex.Lock()
+	defer recordingMutex.Unlock()
+	return recordingFile != ""
+}
+
+// toggleRecording starts or stops the recording and reports it in
+// the viewer.
+func toggleRecording() {
+	if isRecording() {
+		if err := stopRecording(); err != nil {
+			notify("recording: %s", err)
+			return
+		}
+		notify("recording stopped")
+		return
+	}
+	filename := recordFile
+	if filename == "" {
+		filename = filepath.Join(snapshotDir, fmt.Sprintf(
+			"qiview-%s-%s.avi", cameraName,
+			time.Now().Format("20060102-150405")))
+	}
+	filename = unusedName(filename)
+	startRecording(filename)
+	notify("recording %s", filename)
+}
+
+// unusedName returns filename if no such file exists. Otherwise it
+// adds a number before the extension, so that restarting a recording
+// does not overwrite the previous one.
+func unusedName(filename string) string {
+	ext := filepath.Ext(filename)
+	base := strings.TrimSuffix(filename, ext)
+	name := filename
+	for i := 2; ; i++ {
+		if _, err := os.Stat(name); os.IsNotExist(err) {
+			return name
+		}
+		name = fmt.Sprintf("%s-%d%s", base, i, ext)
+	}
+}
+
+// recordFrame adds the frame to the recording if any. On error the
+// recording is stopped.
+func recordFrame(frame *Frame) {
+	recordingMutex.Lock()
+	defer recordingMutex.Unlock()
+	if recordingFile == "" {
+		return
+	}
+	if recording == nil {
+		writer, err := newFrameWriter(recordingFile, frame)
+		if err != nil {
+			notify("recording: %s", err)
+			recordingFile = ""
+			return
+		}
+		recording = writer
+	}
+	if err := recording.WriteFrame(frame); err != nil {
+		notify("recording stopped: %s", err)
+		if err := recording.Close(); err != nil {
+			notify("recording: %s", err)
+		}
+		recording = nil
+		recordingFile = ""
+	}
+}
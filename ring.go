@@ -0,0 +1,91 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// frameRing keeps the last frames received in a bounded buffer.
+type frameRing struct {
+	mutex  sync.Mutex
+	frames []*Frame
+	start  int // index of the oldest frame
+	count  int
+	// number of frames dropped since the creation of the buffer.
+	dropped int
+}
+
+func newFrameRing(size int) *frameRing {
+	if size < 1 {
+		size = 1
+	}
+	return &frameRing{
+		frames: make([]*Frame, size),
+	}
+}
+
+// Push adds a frame, dropping the oldest one when the buffer is full.
+func (r *frameRing) Push(frame *Frame) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.count < len(r.frames) {
+		r.frames[(r.start+r.count)%len(r.frames)] = frame
+		r.count++
+		return
+	}
+	r.frames[r.start] = frame
+	r.start = (r.start + 1) % len(r.frames)
+	r.dropped++
+}
+
+// Dropped returns the number of frames dropped so far. The frame i
+// was the frame i+Dropped() since the creation of the buffer.
+func (r *frameRing) Dropped() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.dropped
+}
+
+// Len returns the number of frames in the buffer.
+func (r *frameRing) Len() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.count
+}
+
+// At returns the frame i, 0 being the oldest frame.
+func (r *frameRing) At(i int) *Frame {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if i < 0 || i >= r.count {
+		return nil
+	}
+	return r.frames[(r.start+i)%len(r.frames)]
+}
+
+// Last returns the frames received during the duration d before the
+// most recent frame, oldest first. It stops at a timestamp going
+// backward, for example when a replay loops.
+func (r *frameRing) Last(d time.Duration) []*Frame {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.count == 0 {
+		return nil
+	}
+	newest := r.frames[(r.start+r.count-1)%len(r.frames)]
+	first := r.count - 1
+	for i := r.count - 2; i >= 0; i-- {
+		frame := r.frames[(r.start+i)%len(r.frames)]
+		next := r.frames[(r.start+i+1)%len(r.frames)]
+		if frame.Timestamp.After(next.Timestamp) ||
+			newest.Timestamp.Sub(frame.Timestamp) > d {
+			break
+		}
+		first = i
+	}
+	frames := make([]*Frame, 0, r.count-first)
+	for i := first; i < r.count; i++ {
+		frames = append(frames, r.frames[(r.start+i)%len(r.frames)])
+	}
+	return frames
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/lugu/qiloop/type/value"
+)
+
+// rollKey is the roll of the torso measured by the inertial unit, in
+// radians. The head has no roll joint: it is also the camera roll.
+const rollKey = "Device/SubDeviceList/InertialSensor/AngleX/Sensor/Value"
+
+var (
+	// robotRoll reads the camera roll from the robot instead of
+	// using cameraRoll alone, which is then added as an offset.
+	robotRoll   = false
+	rollPeriod  = 200 * time.Millisecond
+	rollMinStep = 2.0 // degrees
+)
+
+// readRoll returns the camera roll in degrees.
+func readRoll(memory ALMemoryProxy) (float64, error) {
+	v, err := memory.GetData(rollKey)
+	if err != nil {
+		return 0, fmt.Errorf("read roll: %s", err)
+	}
+	angle, ok := v.(value.FloatValue)
+	if !ok {
+		return 0, fmt.Errorf("read roll: unexpected value %#v", v)
+	}
+	return float64(angle.Value()) * 180 / math.Pi, nil
+}
+
+// watchRoll updates the angles of the face detection with the roll
+// of the robot. The angles change only when the roll moves by more
+// than rollMinStep to avoid jitter.
+func watchRoll(memory ALMemoryProxy) {
+	last := math.NaN()
+	for {
+		roll, err := readRoll(memory)
+		if err != nil {
+			notify("%s", err)
+		} else if math.IsNaN(last) || math.Abs(roll-last) >= rollMinStep {
+			last = roll
+			angles := sweepAngles(faceSweep, faceSweepStep, cameraRoll+roll)
+			detectorMutex.Lock()
+			detector.Params.Angles = angles
+			detectorMutex.Unlock()
+		}
+		time.Sleep(rollPeriod)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/lugu/qiview/face"
+)
+
+var (
+	snapshotDir     = "."
+	snapshotOverlay = false
+)
+
+// snapshotInfo is the content of the JSON file written next to a
+// snapshot.
+type snapshotInfo struct {
+	Camera     string           `json:"camera"`
+	CameraID   int              `json:"camera_id"`
+	Width      int              `json:"width"`
+	Height     int              `json:"height"`
+	Resolution string           `json:"resolution"`
+	ColorSpace string           `json:"colorspace"`
+	Timestamp  time.Time        `json:"timestamp"`
+	Angles     [4]float64       `json:"angles"`
+	RobotURL   string           `json:"robot_url"`
+	Image      string           `json:"image"`
+	Overlay    string           `json:"overlay,omitempty"`
+	Faces      []face.Detection `json:"faces"`
+	// FacesTimestamp is the timestamp of the frame the faces were
+	// found in: the detection runs in the background and can lag
+	// behind the saved frame.
+	FacesTimestamp *time.Time `json:"faces_timestamp,omitempty"`
+}
+
+// robotURL returns the address given on the command line.
+func robotURL() string {
+	if f := flag.Lookup("qi-url"); f != nil {
+		return f.Value.String()
+	}
+	return ""
+}
+
+// publicURL removes the user name and password of an address.
+func publicURL(address string) string {
+	u, err := url.Parse(address)
+	if err != nil {
+		return ""
+	}
+	u.User = nil
+	return u.String()
+}
+
+func writePNG(filename string, img image.Image) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(file, img); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// snapshot saves the last frame as a PNG file into snapshotDir with a
+// JSON file describing it. It returns the name of the PNG file.
+func snapshot() (string, error) {
+	if lastFrame == nil {
+		return "", fmt.Errorf("no frame to save")
+	}
+	if err := os.MkdirAll(snapshotDir, 0755); err != nil {
+		return "", fmt.Errorf("snapshot directory: %s", err)
+	}
+	base := filepath.Join(snapshotDir, fmt.Sprintf("qiview-%s-%s",
+		cameraName, lastFrame.Timestamp.Format("20060102-150405.000000")))
+
+	info := snapshotInfo{
+		Camera:     cameraName,
+		CameraID:   lastFrame.Camera,
+		Width:      lastFrame.Width,
+		Height:     lastFrame.Height,
+		Resolution: resolutionName(resolution),
+		ColorSpace: colorSpaceName(lastFrame.ColorSpace),
+		Timestamp:  lastFrame.Timestamp,
+		Angles:     lastFrame.Angles,
+		RobotURL:   gallerySource(),
+		Image:      filepath.Base(base + ".png"),
+		Faces:      lastFaces,
+	}
+	if !lastFacesTime.IsZero() {
+		info.FacesTimestamp = &lastFacesTime
+	}
+	if err := writePNG(base+".png", lastRaw); err != nil {
+		return "", fmt.Errorf("snapshot: %s", err)
+	}
+	if snapshotOverlay {
+		info.Overlay = filepath.Base(base + "-overlay.png")
+		if err := writePNG(base+"-overlay.png", lastImage); err != nil {
+			return "", fmt.Errorf("snapshot overlay: %s", err)
+		}
+	}
+	data, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := ioutil.WriteFile(base+".json", data, 0644); err != nil {
+		return "", fmt.Errorf("snapshot metadata: %s", err)
+	}
+	return base + ".png", nil
+}
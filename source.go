@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// frameSource produces the frames displayed by the viewer.
+type frameSource interface {
+	Next() (*Frame, error)
+	Close() error
+}
+
+// remoteSource reads the frames from a camera subscription.
+type remoteSource struct {
+	device ALVideoDeviceProxy
+	id     string
+}
+
+func subscribe(device ALVideoDeviceProxy, camera int) (*remoteSource, error) {
+	name, err := device.SubscribeCamera(id, int32(camera),
+		int32(resolution), int32(colorSpace), int32(fps))
+	if err != nil {
+		device.Unsubscribe(name)
+		return nil, fmt.Errorf("failed to initialize camera: %s", err)
+	}
+	return &remoteSource{
+		device: device,
+		id:     name,
+	}, nil
+}
+
+func (r *remoteSource) Next() (*Frame, error) {
+	img, err := r.device.GetImageRemote(r.id)
+	if err != nil {
+		return nil, fmt.Errorf("GetImageRemote: %s", err)
+	}
+	return parseFrame(img)
+}
+
+func (r *remoteSource) Close() error {
+	_, err := r.device.Unsubscribe(r.id)
+	return err
+}
+
+// replayRealtime plays the recordings at their original pace,
+// skipping frames when the viewer is too slow. Otherwise every frame
+// is returned in order, whatever the processing time.
+var replayRealtime = true
+
+// replaySource plays a recording in a loop, at its original pace if
+// realtime is true.
+type replaySource struct {
+	reader   *qvrReader
+	realtime bool
+	start    time.Time // when the loop started
+	last     int       // last frame returned
+}
+
+func openReplay(filename string, realtime bool) (*replaySource, error) {
+	reader, err := openQVR(filename)
+	if err != nil {
+		return nil, err
+	}
+	return &replaySource{
+		reader:   reader,
+		realtime: realtime,
+		last:     -1,
+	}, nil
+}
+
+// Next returns the frame following the last one, or in realtime
+// the last frame recorded before the elapsed time.
+func (r *replaySource) Next() (*Frame, error) {
+	if !r.realtime {
+		r.last = (r.last + 1) % r.reader.Len()
+		return r.reader.Frame(r.last)
+	}
+	now := time.Now()
+	if r.last < 0 {
+		r.start = now
+	}
+	first := r.reader.Timestamp(0)
+	elapsed := now.Sub(r.start)
+	i := r.last
+	if i < 0 {
+		i = 0
+	}
+	for i+1 < r.reader.Len() &&
+		r.reader.Timestamp(i+1).Sub(first) <= elapsed {
+		i++
+	}
+	if i == r.last && i+1 == r.reader.Len() {
+		// end of the recording: start again.
+		r.start = now
+		i = 0
+	}
+	r.last = i
+	return r.reader.Frame(i)
+}
+
+func (r *replaySource) Close() error {
+	return r.reader.Close()
+}
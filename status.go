@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	statusText  string
+	statusTime  time.Time
+	statusMutex sync.Mutex
+)
+
+// notify displays a message in the viewer for a few seconds.
+func notify(format string, args ...interface{}) {
+	statusMutex.Lock()
+	defer statusMutex.Unlock()
+	statusText = fmt.Sprintf(format, args...)
+	statusTime = time.Now()
+}
+
+// status returns the message to display or an empty string.
+func status() string {
+	statusMutex.Lock()
+	defer statusMutex.Unlock()
+	if time.Since(statusTime) > 3*time.Second {
+		return ""
+	}
+	return statusText
+}
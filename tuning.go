@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/lugu/qiview/face"
+)
+
+var (
+	faceParams = face.DefaultParams
+
+	// index in faceControls of the parameter changed with the up
+	// and down keys.
+	selectedParam = 0
+)
+
+// paramControl describes how to display and change a detection
+// parameter.
+type paramControl struct {
+	name   string
+	value  func(p *face.Params) string
+	adjust func(p *face.Params, steps int)
+}
+
+var faceControls = []paramControl{
+	{
+		name:  "min",
+		value: func(p *face.Params) string { return fmt.Sprintf("%d", p.MinSize) },
+		adjust: func(p *face.Params, steps int) {
+			p.MinSize = clampInt(p.MinSize+5*steps, 1, p.MaxSize)
+		},
+	},
+	{
+		name:  "max",
+		value: func(p *face.Params) string { return fmt.Sprintf("%d", p.MaxSize) },
+		adjust: func(p *face.Params, steps int) {
+			p.MaxSize = clampInt(p.MaxSize+50*steps, p.MinSize, 10000)
+		},
+	},
+	{
+		name:  "shift",
+		value: func(p *face.Params) string { return fmt.Sprintf("%.2f", p.ShiftFactor) },
+		adjust: func(p *face.Params, steps int) {
+			p.ShiftFactor = clampFloat(p.ShiftFactor+0.01*float64(steps), 0.01, 1)
+		},
+	},
+	{
+		name:  "scale",
+		value: func(p *face.Params) string { return fmt.Sprintf("%.2f", p.ScaleFactor) },
+		adjust: func(p *face.Params, steps int) {
+			p.ScaleFactor = clampFloat(p.ScaleFactor+0.01*float64(steps), 1.01, 2)
+		},
+	},
+	{
+		name:  "iou",
+		value: func(p *face.Params) string { return fmt.Sprintf("%.2f", p.IoUThreshold) },
+		adjust: func(p *face.Params, steps int) {
+			p.IoUThreshold = clampFloat(p.IoUThreshold+0.05*float64(steps), 0, 1)
+		},
+	},
+	{
+		name:  "q",
+		value: func(p *face.Params) string { return fmt.Sprintf("%.1f", p.QThreshold) },
+		adjust: func(p *face.Params, steps int) {
+			p.QThreshold = float32(clampFloat(float64(p.QThreshold)+0.5*float64(steps), 0, 100))
+		},
+	},
+}
+
+func clampInt(value, min, max int) int {
+	if value < min {
+		return min
+	}
+	if value > max {
+		return max
+	}
+	return value
+}
+
+func clampFloat(value, min, max float64) float64 {
+	return math.Max(min, math.Min(max, value))
+}
+
+// selectParam selects the next detection parameter.
+func selectParam() {
+	selectedParam = (selectedParam + 1) % len(faceControls)
+}
+
+// adjustParam changes the selected parameter of the detector. A
+// change which would prevent the detection from ending is refused.
+func adjustParam(steps int) {
+	if detector == nil {
+		return
+	}
+	detectorMutex.Lock()
+	defer detectorMutex.Unlock()
+	params := detector.Params
+	faceControls[selectedParam].adjust(&params, steps)
+	if err := params.Validate(); err != nil {
+		notify("%s", err)
+		return
+	}
+	detector.Params = params
+}
+
+// paramsText describes the detection parameters, the selected one is
+// between brackets, followed by the detection latency.
+func paramsText() string {
+	if detector == nil {
+		return ""
+	}
+	detectorMutex.Lock()
+	defer detectorMutex.Unlock()
+	fields := make([]string, len(faceControls))
+	for i, control := range faceControls {
+		fields[i] = control.name + "=" + control.value(&detector.Params)
+		if i == selectedParam {
+			fields[i] = "[" + fields[i] + "]"
+		}
+	}
+	fields = append(fields, detectionText())
+	return "face " + strings.Join(fields, " ")
+}
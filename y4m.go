@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"image/color"
+	"io"
+	"os"
+	"time"
+)
+
+var y4mFile = ""
+
+// y4mWriter writes frames as a YUV4MPEG2 stream. The chroma
+// subsampling depends on the color space of the first frame: yuv422
+// frames are written as 4:2:2, depth frames as monochrome and the
+// others as 4:4:4.
+type y4mWriter struct {
+	out        *bufio.Writer
+	width      int
+	heigh      int
+	colorSpace int
+	planes     [3][]byte
+}
+
+func newY4MWriter(w io.Writer) *y4mWriter {
+	return &y4mWriter{
+		out: bufio.NewWriter(w),
+	}
+}
+
+func (y *y4mWriter) writeHeader(frame *Frame) error {
+	y.width, y.heigh = frame.Width, frame.Height
+	y.colorSpace = frame.ColorSpace
+	chroma := "444"
+	switch frame.ColorSpace {
+	case yuv422:
+		chroma = "422"
+	case depth, dist:
+		chroma = "mono"
+	}
+	_, err := fmt.Fprintf(y.out,
+		"YUV4MPEG2 W%d H%d F%d:1 Ip A1:1 C%s XCOLORRANGE=FULL\n",
+		y.width, y.heigh, fps, chroma)
+	return err
+}
+
+// convert fills the Y, U and V planes with the frame pixels.
+func (y *y4mWriter) convert(frame *Frame) {
+	pixels := frame.Width * frame.Height
+	for i := range y.planes {
+		y.planes[i] = y.planes[i][:0]
+	}
+	switch frame.ColorSpace {
+	case yuv422:
+		// Y0 U Y1 V
+		for i := 0; i+3 < len(frame.Pixels) && i < 2*pixels; i += 4 {
+			y.planes[0] = append(y.planes[0], frame.Pixels[i], frame.Pixels[i+2])
+			y.planes[1] = append(y.planes[1], frame.Pixels[i+1])
+			y.planes[2] = append(y.planes[2], frame.Pixels[i+3])
+		}
+	case yuv:
+		for i := 0; i+2 < len(frame.Pixels) && i < 3*pixels; i += 3 {
+			for p := range y.planes {
+				y.planes[p] = append(y.planes[p], frame.Pixels[i+p])
+			}
+		}
+	case depth, dist:
+		img := frame.Image()
+		for i := 0; i < pixels; i++ {
+			y.planes[0] = append(y.planes[0], img.pixels[3*i])
+		}
+	default:
+		img := frame.Image()
+		for i := 0; i < pixels; i++ {
+			Y, U, V := color.RGBToYCbCr(img.pixels[3*i],
+				img.pixels[3*i+1], img.pixels[3*i+2])
+			y.planes[0] = append(y.planes[0], Y)
+			y.planes[1] = append(y.planes[1], U)
+			y.planes[2] = append(y.planes[2], V)
+		}
+	}
+}
+
+// planeSize returns the number of bytes of a plane.
+func (y *y4mWriter) planeSize(plane int) int {
+	if plane == 0 {
+		return y.width * y.heigh
+	}
+	switch y.colorSpace {
+	case yuv422:
+		return y.width / 2 * y.heigh
+	case depth, dist:
+		return 0
+	}
+	return y.width * y.heigh
+}
+
+// WriteFrame writes the frame. The stream header is written with
+// the first frame.
+func (y *y4mWriter) WriteFrame(frame *Frame) error {
+	if y.width == 0 {
+		if err := y.writeHeader(frame); err != nil {
+			return err
+		}
+	} else if frame.Width != y.width || frame.Height != y.heigh ||
+		frame.ColorSpace != y.colorSpace {
+		return fmt.Errorf("frame format changed")
+	}
+	y.convert(frame)
+	y.out.WriteString("FRAME\n")
+	for i, plane := range y.planes {
+		// pad incomplete frames to keep the stream valid.
+		for len(plane) < y.planeSize(i) {
+			plane = append(plane, 0x80)
+		}
+		y.out.Write(plane)
+	}
+	return y.out.Flush()
+}
+
+// streamY4M writes the frames to y4mFile ("-" for stdout) until an
+// error occurs.
+func streamY4M() error {
+	var w io.Writer = os.Stdout
+	if y4mFile != "-" {
+		// os.Create also opens named pipes.
+		file, err := os.Create(y4mFile)
+		if err != nil {
+			return fmt.Errorf("y4m output: %s", err)
+		}
+		defer file.Close()
+		w = file
+	}
+	writer := newY4MWriter(w)
+	for {
+		start := time.Now()
+		frame, err := nextFrame()
+		if err != nil {
+			return err
+		}
+		if err := writer.WriteFrame(frame); err != nil {
+			return fmt.Errorf("y4m output: %s", err)
+		}
+		time.Sleep(time.Second/time.Duration(fps) - time.Since(start))
+	}
+}